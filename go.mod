@@ -3,6 +3,7 @@ module github.com/knaka/binc
 go 1.21.6
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/h2non/filetype v1.1.3
 	github.com/knaka/go-testutils v0.0.2024030337
 	github.com/knaka/go-utils v0.0.2024030337
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+type buildResultT struct {
+	Name     string
+	Skipped  bool
+	Err      error
+	Duration time.Duration
+}
+
+// buildCommand builds the command with its active manager if the manager can build ahead of time.
+func buildCommand(resolution *resolutionT, shouldRebuild bool) (result *buildResultT) {
+	result = &buildResultT{Name: resolution.Name}
+	builder, ok := resolution.Winner.Manager.(common.Builder)
+	if !ok {
+		result.Skipped = true
+		return result
+	}
+	startTime := time.Now()
+	result.Err = builder.Build(resolution.Name, shouldRebuild)
+	result.Duration = time.Since(startTime)
+	return result
+}
+
+// build builds the given commands, or all the commands, into the cache without running them.
+func build(args []string, shouldRebuild bool, out io.Writer) (err error) {
+	defer Catch(&err)
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	all := flags.Bool("all", false, "build all the commands")
+	rebuild := flags.Bool("rebuild", false, "rebuild even if cached")
+	numJobs := flags.Int("j", 1, "number of parallel builds")
+	V0(flags.Parse(args))
+	names := flags.Args()
+	if !*all && len(names) == 0 {
+		return errors.New("no command specified; give command names or --all")
+	}
+	if *numJobs < 1 {
+		*numJobs = 1
+	}
+	var resolutions []*resolutionT
+	var results []*buildResultT
+	if *all {
+		resolutions = V(resolveAll())
+	} else {
+		for _, name := range names {
+			resolution, err := resolveCommandOrAlias(name)
+			if err != nil {
+				results = append(results, &buildResultT{Name: name, Err: err})
+				continue
+			}
+			resolutions = append(resolutions, resolution)
+		}
+	}
+	resultCh := make(chan *buildResultT)
+	resolutionCh := make(chan *resolutionT)
+	var wg sync.WaitGroup
+	for i := 0; i < *numJobs; i++ {
+		wg.Add(1)
+		go (func() {
+			defer wg.Done()
+			for resolution := range resolutionCh {
+				resultCh <- buildCommand(resolution, shouldRebuild || *rebuild)
+			}
+		})()
+	}
+	go (func() {
+		for _, resolution := range resolutions {
+			resolutionCh <- resolution
+		}
+		close(resolutionCh)
+		wg.Wait()
+		close(resultCh)
+	})()
+	for result := range resultCh {
+		results = append(results, result)
+	}
+	// Report in the order of the commands rather than the order of completion.
+	order := map[string]int{}
+	for i, resolution := range resolutions {
+		order[resolution.Name] = i
+	}
+	orderOf := func(result *buildResultT) int {
+		if i, ok := order[result.Name]; ok {
+			return i
+		}
+		return -1
+	}
+	slices.SortStableFunc(results, func(a, b *buildResultT) int {
+		return orderOf(a) - orderOf(b)
+	})
+	numFailures := 0
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			numFailures++
+			V0(fmt.Fprintf(out, "FAIL\t%s\t%.2fs\t%v\n", result.Name, result.Duration.Seconds(), result.Err))
+		case result.Skipped:
+			V0(fmt.Fprintf(out, "skip\t%s\t(not cacheable)\n", result.Name))
+		default:
+			V0(fmt.Fprintf(out, "ok\t%s\t%.2fs\n", result.Name, result.Duration.Seconds()))
+		}
+	}
+	if numFailures > 0 {
+		return errors.New(fmt.Sprintf("%d of %d builds failed", numFailures, len(results)))
+	}
+	return nil
+}
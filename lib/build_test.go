@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"bytes"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	common.ResetConfig()
+	defer common.ResetConfig()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	dirPath := filepath.Join(t.TempDir(), "bin")
+	V0(os.MkdirAll(dirPath, 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, "go.mod"), []byte("module example.com/bin\n\ngo 1.21\n"), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "good.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "bad.go"), []byte("package main\n\nfunc main() { undefined() }\n"), 0644))
+	t.Setenv("BINCPATH", dirPath)
+
+	var buf bytes.Buffer
+	V0(build([]string{"good"}, false, &buf))
+	assert.Regexp(t, `^ok\tgood\t`, buf.String())
+	entry, _ := lo.Find(V(listEntries()), func(entry *listEntryT) bool {
+		return entry.Name == "good"
+	})
+	assert.True(t, *entry.Cached)
+
+	buf.Reset()
+	err := build([]string{"-j", "2", "--all"}, false, &buf)
+	assert.Error(t, err)
+	assert.Regexp(t, `(?m)^FAIL\tbad\t`, buf.String())
+	assert.Regexp(t, `(?m)^ok\tgood\t`, buf.String())
+
+	buf.Reset()
+	assert.Error(t, build([]string{"nonexistent"}, false, &buf))
+}
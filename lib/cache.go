@@ -0,0 +1,219 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"T", 1 << 40},
+}
+
+// parseSize parses a size such as “500M” or “2G”. A size without a unit is in bytes.
+func parseSize(s string) (size int64, err error) {
+	s = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			multiplier = unit.size
+			s = strings.TrimSuffix(s, unit.suffix)
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, errors.New(fmt.Sprintf("invalid size: %s", s))
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+func formatSize(size int64) string {
+	for i := len(sizeUnits) - 1; i >= 0; i-- {
+		if size >= sizeUnits[i].size {
+			return fmt.Sprintf("%.1f%s", float64(size)/float64(sizeUnits[i].size), sizeUnits[i].suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+type cacheEntryJsonT struct {
+	Hash      string            `json:"hash"`
+	Path      string            `json:"path"`
+	BuildInfo *common.BuildInfo `json:"build_info"`
+	Size      int64             `json:"size"`
+	LastUsed  time.Time         `json:"last_used"`
+	Orphaned  bool              `json:"orphaned"`
+}
+
+// cacheEntriesByLastUsed returns the cache entries from the least recently used one.
+func cacheEntriesByLastUsed() (entries []*common.CacheEntry, err error) {
+	defer Catch(&err)
+	entries = V(common.CacheEntries(V(common.CacheRootDirPath())))
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+func cacheLs(args []string, out io.Writer) (err error) {
+	defer Catch(&err)
+	flags := flag.NewFlagSet("cache ls", flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "output in JSON")
+	V0(flags.Parse(args))
+	entries := V(cacheEntriesByLastUsed())
+	if *jsonOutput {
+		jsonEntries := []*cacheEntryJsonT{}
+		for _, entry := range entries {
+			jsonEntries = append(jsonEntries, &cacheEntryJsonT{
+				Hash:      entry.HashStr,
+				Path:      entry.DirPath,
+				BuildInfo: entry.BuildInfo,
+				Size:      entry.Size,
+				LastUsed:  entry.LastUsed,
+				Orphaned:  entry.IsOrphaned(),
+			})
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(jsonEntries)
+	}
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	V0(fmt.Fprintln(writer, "HASH\tSIZE\tLAST USED\tVERSION\tARGS\tFILES"))
+	for _, entry := range entries {
+		version, args, files := "-", "-", "(no build information)"
+		if entry.BuildInfo != nil {
+			version = Ternary(entry.BuildInfo.Version != "", entry.BuildInfo.Version, "-")
+			args = strings.Join(append(slices.Clone(entry.BuildInfo.Env), entry.BuildInfo.Args...), " ")
+			files = strings.Join(entry.SourceFilePaths(), ",")
+		}
+		V0(fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%q\t%s\n",
+			entry.HashStr,
+			formatSize(entry.Size),
+			entry.LastUsed.Format(time.DateTime),
+			version,
+			args,
+			files,
+		))
+	}
+	return writer.Flush()
+}
+
+func cacheDu(out io.Writer) (err error) {
+	defer Catch(&err)
+	entries := V(cacheEntriesByLastUsed())
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	V0(fmt.Fprintf(out, "%s\t%d entries\t%s\n", formatSize(total), len(entries), V(common.CacheRootDirPath())))
+	return nil
+}
+
+// pruneOptionsT is the policy of pruning. Zero values disable the corresponding criteria.
+type pruneOptionsT struct {
+	olderThan time.Duration
+	maxSize   int64
+	orphaned  bool
+}
+
+// entriesToPrune selects the entries to remove from the entries sorted from the least recently used one:
+// the ones not used for the duration, the orphaned ones, and then the least recently used ones until the total size fits in the budget.
+func entriesToPrune(entries []*common.CacheEntry, options pruneOptionsT, now time.Time) (pruned []*common.CacheEntry) {
+	var remaining []*common.CacheEntry
+	var remainingSize int64
+	for _, entry := range entries {
+		if (options.olderThan > 0 && entry.LastUsed.Before(now.Add(-options.olderThan))) ||
+			(options.orphaned && entry.IsOrphaned()) {
+			pruned = append(pruned, entry)
+			continue
+		}
+		remaining = append(remaining, entry)
+		remainingSize += entry.Size
+	}
+	if options.maxSize > 0 {
+		for _, entry := range remaining {
+			if remainingSize <= options.maxSize {
+				break
+			}
+			pruned = append(pruned, entry)
+			remainingSize -= entry.Size
+		}
+	}
+	return pruned
+}
+
+func cachePrune(args []string, out io.Writer) (err error) {
+	defer Catch(&err)
+	flags := flag.NewFlagSet("cache prune", flag.ContinueOnError)
+	olderThanDays := flags.Int("older-than", 0, "remove the entries not used for the number of days")
+	maxSizeStr := flags.String("max-size", "", "remove the least recently used entries until the total size fits (e.g. 500M, 2G)")
+	orphaned := flags.Bool("orphaned", false, "remove the entries whose sources no longer exist")
+	dryRun := flags.Bool("dry-run", false, "only print the entries to remove")
+	V0(flags.Parse(args))
+	options := pruneOptionsT{
+		olderThan: time.Duration(*olderThanDays) * 24 * time.Hour,
+		orphaned:  *orphaned,
+	}
+	if *maxSizeStr != "" {
+		options.maxSize = V(parseSize(*maxSizeStr))
+	}
+	if options == (pruneOptionsT{}) {
+		return errors.New("no criteria specified; give --older-than, --max-size or --orphaned")
+	}
+	var freed int64
+	pruned := entriesToPrune(V(cacheEntriesByLastUsed()), options, time.Now())
+	for _, entry := range pruned {
+		if !*dryRun {
+			V0(os.RemoveAll(entry.DirPath))
+		}
+		freed += entry.Size
+		V0(fmt.Fprintf(out, "%s\t%s\n", Ternary(*dryRun, "would remove", "removed"), entry.DirPath))
+	}
+	V0(fmt.Fprintf(out, "%d entries, %s\n", len(pruned), formatSize(freed)))
+	return nil
+}
+
+func cacheClear(out io.Writer) (err error) {
+	defer Catch(&err)
+	entries := V(common.CacheEntries(V(common.CacheRootDirPath())))
+	for _, entry := range entries {
+		V0(os.RemoveAll(entry.DirPath))
+	}
+	V0(fmt.Fprintf(out, "%d entries removed\n", len(entries)))
+	return nil
+}
+
+func cacheCommand(args []string, out io.Writer) (err error) {
+	if len(args) == 0 {
+		return errors.New("no cache subcommand specified")
+	}
+	switch args[0] {
+	case "ls", "list":
+		return cacheLs(args[1:], out)
+	case "du":
+		return cacheDu(out)
+	case "prune":
+		return cachePrune(args[1:], out)
+	case "clear":
+		return cacheClear(out)
+	}
+	return errors.New(fmt.Sprintf("unknown cache subcommand: %s", args[0]))
+}
@@ -0,0 +1,39 @@
+package lib
+
+import (
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	assert.Equal(t, int64(100), V(parseSize("100")))
+	assert.Equal(t, int64(500<<20), V(parseSize("500M")))
+	assert.Equal(t, int64(3<<29), V(parseSize("1.5GiB")))
+	_, err := parseSize("big")
+	assert.Error(t, err)
+}
+
+func TestEntriesToPrune(t *testing.T) {
+	now := time.Now()
+	info := &common.BuildInfo{}
+	// From the least recently used one
+	entries := []*common.CacheEntry{
+		{HashStr: "old", BuildInfo: info, Size: 10, LastUsed: now.AddDate(0, 0, -100)},
+		{HashStr: "broken", Size: 10, LastUsed: now.AddDate(0, 0, -50)},
+		{HashStr: "lru", BuildInfo: info, Size: 30, LastUsed: now.AddDate(0, 0, -10)},
+		{HashStr: "mru", BuildInfo: info, Size: 30, LastUsed: now},
+	}
+	hashStrs := func(entries []*common.CacheEntry) (hashStrs []string) {
+		for _, entry := range entries {
+			hashStrs = append(hashStrs, entry.HashStr)
+		}
+		return hashStrs
+	}
+	assert.Equal(t, []string{"old"}, hashStrs(entriesToPrune(entries, pruneOptionsT{olderThan: 90 * 24 * time.Hour}, now)))
+	assert.Equal(t, []string{"broken"}, hashStrs(entriesToPrune(entries, pruneOptionsT{orphaned: true}, now)))
+	assert.Equal(t, []string{"old", "broken", "lru"}, hashStrs(entriesToPrune(entries, pruneOptionsT{maxSize: 40}, now)))
+	assert.Equal(t, []string{"old", "broken"}, hashStrs(entriesToPrune(entries, pruneOptionsT{maxSize: 60}, now)))
+}
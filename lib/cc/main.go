@@ -0,0 +1,359 @@
+package cc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/samber/lo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var cExtensions = []string{
+	".c",
+}
+
+var cxxExtensions = []string{
+	".cc",
+	".cpp",
+}
+
+// directivePrefixes are the prefixes of the comments which give flags to the compiler, such as “// binc: -lm”.
+var directivePrefixes = []string{
+	"// binc:",
+	"//binc:",
+}
+
+// Environment variables which affect the build.
+var buildEnvNames = []string{
+	"CC",
+	"CXX",
+	"CFLAGS",
+	"CXXFLAGS",
+	"LDFLAGS",
+}
+
+// Patterns of the files of the projects of other build tools, whose C/C++ sources are not commands
+// but parts of them, such as cgo sources, shims of Rust crates, “cbits” of Haskell packages and Python and Node.js extensions.
+var projectFilePatterns = []string{
+	"go.mod",
+	"*.go",
+	"Cargo.toml",
+	"*.cabal",
+	"setup.py",
+	"pyproject.toml",
+	"binding.gyp",
+	"CMakeLists.txt",
+	"Makefile",
+	"makefile",
+	"GNUmakefile",
+}
+
+// isProjectDir checks if the directory is a project of another build tool.
+func isProjectDir(dirPath string) bool {
+	for _, pattern := range projectFilePatterns {
+		if filePaths, err := filepath.Glob(filepath.Join(dirPath, pattern)); err == nil && len(filePaths) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isSourceFile(filePath string) bool {
+	return slices.Contains(cExtensions, filepath.Ext(filePath)) || slices.Contains(cxxExtensions, filepath.Ext(filePath))
+}
+
+func isCxxSourceFile(filePath string) bool {
+	return slices.Contains(cxxExtensions, filepath.Ext(filePath))
+}
+
+// sourceFiles returns the source files of the target, which is either a source file or a directory of them.
+func sourceFiles(targetPath string) (filePaths []string, err error) {
+	defer Catch(&err)
+	if stat := V(os.Stat(targetPath)); !stat.IsDir() {
+		return []string{targetPath}, nil
+	}
+	for _, dirEntry := range V(os.ReadDir(targetPath)) {
+		if !dirEntry.IsDir() && isSourceFile(dirEntry.Name()) {
+			filePaths = append(filePaths, filepath.Join(targetPath, dirEntry.Name()))
+		}
+	}
+	return filePaths, nil
+}
+
+var reLocalInclude = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`^\s*#\s*include\s*"([^"]+)"`)
+})
+
+// scanSourceFile reads the flags in the directives of the file and the local headers it includes.
+func scanSourceFile(filePath string) (flags []string, headerPaths []string, err error) {
+	defer Catch(&err)
+	in := V(os.Open(filePath))
+	defer (func() { Ignore(in.Close()) })()
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmedLine := strings.TrimSpace(line)
+		for _, prefix := range directivePrefixes {
+			if strings.HasPrefix(trimmedLine, prefix) {
+				flags = append(flags, V(common.SplitDirectiveArgs(trimmedLine[len(prefix):]))...)
+				break
+			}
+		}
+		// Only the headers relative to the including file are tracked. The ones not found are left to the compiler.
+		if match := reLocalInclude().FindStringSubmatch(line); match != nil {
+			headerPath := filepath.Join(filepath.Dir(filePath), match[1])
+			if stat, err := os.Stat(headerPath); err == nil && !stat.IsDir() {
+				headerPaths = append(headerPaths, headerPath)
+			}
+		}
+	}
+	V0(scanner.Err())
+	return flags, headerPaths, nil
+}
+
+// buildT is how a target is compiled.
+type buildT struct {
+	compiler     string
+	compileFlags []string
+	sourcePaths  []string
+	linkFlags    []string
+	// filePaths are the source files and the local headers included from them transitively.
+	filePaths []string
+}
+
+func newBuild(targetPath string) (build *buildT, err error) {
+	defer Catch(&err)
+	build = &buildT{
+		sourcePaths: V(sourceFiles(targetPath)),
+	}
+	cxx := lo.ContainsBy(build.sourcePaths, isCxxSourceFile)
+	build.compiler = V(Ternary(cxx, cxxCommand, ccCommand)())
+	build.compileFlags = strings.Fields(os.Getenv(Ternary(cxx, "CXXFLAGS", "CFLAGS")))
+	build.compileFlags = append(build.compileFlags, common.BuildFlags("cc", filepath.Dir(build.sourcePaths[0]))...)
+	var directiveFlags []string
+	visited := map[string]bool{}
+	queue := slices.Clone(build.sourcePaths)
+	for len(queue) > 0 {
+		filePath := queue[0]
+		queue = queue[1:]
+		if visited[filePath] {
+			continue
+		}
+		visited[filePath] = true
+		build.filePaths = append(build.filePaths, filePath)
+		flags, headerPaths, err := scanSourceFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		directiveFlags = append(directiveFlags, flags...)
+		queue = append(queue, headerPaths...)
+	}
+	// The flags in the directives may name libraries, which have to follow the sources.
+	build.linkFlags = append(directiveFlags, strings.Fields(os.Getenv("LDFLAGS"))...)
+	return build, nil
+}
+
+// exeBuildInfo returns the build information of the target and the path of the cached executable for it.
+func exeBuildInfo(targetPath string, cmdBase string) (build *buildT, buildInfo *common.BuildInfo, exePath string, err error) {
+	defer Catch(&err)
+	build = V(newBuild(targetPath))
+	var fileInfoList []*common.FileInfo
+	for _, filePath := range build.filePaths {
+		fileInfoList = append(fileInfoList, V(common.GetFileInfo(filePath)))
+	}
+	// The path of the compiler comes first in the arguments, and its version is the version of the build.
+	args := append([]string{build.compiler}, build.compileFlags...)
+	buildInfo = common.NewBuildInfo(
+		V(compilerVersion(build.compiler)),
+		append(args, build.linkFlags...),
+		fileInfoList,
+	)
+	exePath = V(common.CachedExePath(buildInfo.Hash, cmdBase))
+	return build, buildInfo, exePath, nil
+}
+
+func ensureExeFile(targetPath string, cmdBase string, shouldRebuild bool) (buildInfo *common.BuildInfo, exePath string, err error) {
+	defer Catch(&err)
+	build, buildInfo, exePath, err := exeBuildInfo(targetPath, cmdBase)
+	if err != nil {
+		return nil, "", err
+	}
+	V0(common.EnsureBuilt(buildInfo, exePath, shouldRebuild, func(tempPath string) error {
+		args := slices.Clone(build.compileFlags)
+		args = append(args, "-o", tempPath)
+		args = append(args, build.sourcePaths...)
+		args = append(args, build.linkFlags...)
+		cmd := exec.Command(build.compiler, args...)
+		cmd.Dir = filepath.Dir(build.sourcePaths[0])
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}))
+	return buildInfo, exePath, nil
+}
+
+// --------
+
+type CcManager struct {
+	// targetPaths are the paths of the source files and the directories of them.
+	targetPaths []string
+}
+
+var _ common.Manager = &CcManager{}
+var _ common.CacheChecker = &CcManager{}
+var _ common.Builder = &CcManager{}
+var _ common.FastLauncher = &CcManager{}
+
+func cmdBaseOf(targetPath string) string {
+	base := filepath.Base(targetPath)
+	if isSourceFile(base) {
+		return base[:len(base)-len(filepath.Ext(base))]
+	}
+	return base
+}
+
+func (m *CcManager) findTarget(cmdBase string) (targetPath string, err error) {
+	for _, targetPath := range m.targetPaths {
+		if cmdBaseOf(targetPath) == cmdBase {
+			return targetPath, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("no matching c/c++ source found: %s", cmdBase))
+}
+
+func (m *CcManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
+	for _, targetPath := range m.targetPaths {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    cmdBaseOf(targetPath),
+			SourcePath: targetPath,
+		})
+	}
+	return infoList
+}
+
+func (m *CcManager) CanRun(cmdBase string) bool {
+	_, err := m.findTarget(cmdBase)
+	return err == nil
+}
+
+func (m *CcManager) Run(args []string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	cmdBase := filepath.Base(args[0])
+	_, exePath, err := ensureExeFile(V(m.findTarget(cmdBase)), cmdBase, shouldRebuild)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exePath, args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return common.RunCommand(cmd)
+}
+
+func (m *CcManager) Build(cmdBase string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	_, _, err = ensureExeFile(V(m.findTarget(cmdBase)), cmdBase, shouldRebuild)
+	return err
+}
+
+func (m *CcManager) CachedPath(cmdBase string) (cachedPath string, err error) {
+	defer Catch(&err)
+	_, _, cachedPath, err = exeBuildInfo(V(m.findTarget(cmdBase)), cmdBase)
+	return cachedPath, err
+}
+
+func (m *CcManager) LaunchStamp(cmdBase string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
+	defer Catch(&err)
+	buildInfo, exePath, err := ensureExeFile(V(m.findTarget(cmdBase)), cmdBase, shouldRebuild)
+	if err != nil {
+		return nil, err
+	}
+	// The compiler is found on $PATH unless $CC or $CXX is set, and it can be replaced at the same path.
+	compiler := buildInfo.Args[0]
+	return common.NewLaunchStamp([]string{exePath}, exePath, buildInfo, append(slices.Clone(buildEnvNames), "PATH"), compiler), nil
+}
+
+// compilerCommand returns the command to find the compiler: the environment variable, the configuration, or the default name on $PATH.
+func compilerCommand(envName string, toolName string, defaultName string) func() (string, error) {
+	return func() (compilerPath string, err error) {
+		defer Catch(&err)
+		// $CC may include flags such as “gcc -m32”, which are not supported.
+		if name := os.Getenv(envName); name != "" {
+			return V(exec.LookPath(name)), nil
+		}
+		if path := common.ToolPath(toolName); path != "" {
+			return path, nil
+		}
+		return V(exec.LookPath(defaultName)), nil
+	}
+}
+
+var ccCommand = sync.OnceValues(compilerCommand("CC", "cc", "cc"))
+
+var cxxCommand = sync.OnceValues(compilerCommand("CXX", "c++", "c++"))
+
+var compilerVersions sync.Map
+
+// compilerVersion returns the first line of the version output of the compiler, such as “cc (Debian 12.2.0-14) 12.2.0”.
+func compilerVersion(compilerPath string) (version string, err error) {
+	defer Catch(&err)
+	if version, ok := compilerVersions.Load(compilerPath); ok {
+		return version.(string), nil
+	}
+	output := string(V(exec.Command(compilerPath, "--version").Output()))
+	version, _, _ = strings.Cut(output, "\n")
+	compilerVersions.Store(compilerPath, version)
+	return version, nil
+}
+
+func newCcManager(dirPath string) common.Manager {
+	if E(ccCommand()) != nil && E(cxxCommand()) != nil {
+		return nil
+	}
+	// The sources in a project and in its subdirectories such as “cbits” are parts of it.
+	if isProjectDir(dirPath) {
+		return nil
+	}
+	var targetPaths []string
+	for _, dirEntry := range V(os.ReadDir(dirPath)) {
+		targetPath := filepath.Join(dirPath, dirEntry.Name())
+		if !dirEntry.IsDir() {
+			if isSourceFile(targetPath) {
+				targetPaths = append(targetPaths, targetPath)
+			}
+			continue
+		}
+		if isProjectDir(targetPath) {
+			continue
+		}
+		if sourcePaths := V(sourceFiles(targetPath)); len(sourcePaths) > 0 {
+			targetPaths = append(targetPaths, targetPath)
+		}
+	}
+	targetPaths = lo.Filter(targetPaths, func(targetPath string, _ int) bool {
+		return !strings.HasPrefix(filepath.Base(targetPath), "_") &&
+			!strings.HasPrefix(filepath.Base(targetPath), ".")
+	})
+	if len(targetPaths) == 0 {
+		return nil
+	}
+	return &CcManager{
+		targetPaths: targetPaths,
+	}
+}
+
+func init() {
+	common.RegisterManagerFactory(
+		"C/C++ Manager",
+		newCcManager,
+		50,
+	)
+}
@@ -0,0 +1,98 @@
+package cc
+
+import (
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// The flags in the directives are passed to the compiler, and a change of a local header changes the cache entry.
+func TestEnsureExeFile(t *testing.T) {
+	if _, err := ccCommand(); err != nil {
+		t.Skip("no C compiler")
+	}
+	for _, name := range buildEnvNames {
+		t.Setenv(name, "")
+	}
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	dirPath := filepath.Join(t.TempDir(), "sqrt")
+	V0(os.MkdirAll(dirPath, 0755))
+	headerFilePath := filepath.Join(dirPath, "value.h")
+	V0(os.WriteFile(headerFilePath, []byte("#define VALUE 16.0\n"), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "main.c"), []byte(`// binc: -lm
+#include <math.h>
+#include <stdio.h>
+#include "value.h"
+
+int main(void) {
+	printf("%g\n", sqrt(VALUE));
+	return 0;
+}
+`), 0644))
+	buildInfo, exePath, err := ensureExeFile(dirPath, "sqrt", false)
+	V0(err)
+	assert.Contains(t, buildInfo.Args, "-lm")
+	assert.Len(t, buildInfo.Files, 2)
+	assert.Equal(t, "4\n", string(V(exec.Command(exePath).Output())))
+
+	V0(os.WriteFile(headerFilePath, []byte("#define VALUE 25.0\n"), 0644))
+	_, exePath2, err := ensureExeFile(dirPath, "sqrt", false)
+	V0(err)
+	assert.NotEqual(t, exePath, exePath2)
+	assert.Equal(t, "5\n", string(V(exec.Command(exePath2).Output())))
+}
+
+// The sources in the projects of other build tools are not commands.
+func TestNewCcManager(t *testing.T) {
+	if _, err := ccCommand(); err != nil {
+		t.Skip("no C compiler")
+	}
+	dirPath := t.TempDir()
+	writeFile := func(relPath string) {
+		V0(os.MkdirAll(filepath.Join(dirPath, filepath.Dir(relPath)), 0755))
+		V0(os.WriteFile(filepath.Join(dirPath, relPath), nil, 0644))
+	}
+	writeFile("hello.c")
+	writeFile(filepath.Join("tool", "main.c"))
+	writeFile(filepath.Join("cgo", "go.mod"))
+	writeFile(filepath.Join("cgo", "shim.c"))
+	writeFile(filepath.Join("ext", "setup.py"))
+	writeFile(filepath.Join("ext", "ext.c"))
+	writeFile(filepath.Join("addon", "binding.gyp"))
+	writeFile(filepath.Join("addon", "addon.cc"))
+	writeFile(filepath.Join("lib", "CMakeLists.txt"))
+	writeFile(filepath.Join("lib", "lib.c"))
+	var cmdBases []string
+	for _, info := range newCcManager(dirPath).GetCommandBaseInfoList() {
+		cmdBases = append(cmdBases, info.CmdBase)
+	}
+	assert.ElementsMatch(t, []string{"hello", "tool"}, cmdBases)
+
+	// The “cbits” of a Haskell package are not commands either.
+	projectDirPath := t.TempDir()
+	V0(os.WriteFile(filepath.Join(projectDirPath, "hello.cabal"), nil, 0644))
+	V0(os.MkdirAll(filepath.Join(projectDirPath, "cbits"), 0755))
+	V0(os.WriteFile(filepath.Join(projectDirPath, "cbits", "shim.c"), nil, 0644))
+	assert.Nil(t, newCcManager(projectDirPath))
+}
+
+// The stamp depends on the compiler and on $PATH where it is found.
+func TestLaunchStamp(t *testing.T) {
+	if _, err := ccCommand(); err != nil {
+		t.Skip("no C compiler")
+	}
+	for _, name := range buildEnvNames {
+		t.Setenv(name, "")
+	}
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	dirPath := t.TempDir()
+	V0(os.WriteFile(filepath.Join(dirPath, "hello.c"), []byte("int main(void) { return 0; }\n"), 0644))
+	stamp := V(newCcManager(dirPath).(*CcManager).LaunchStamp("hello", false))
+	assert.Contains(t, stamp.Env, "PATH")
+	assert.Contains(t, lo.Map(stamp.Files, func(fileStat *common.FileStat, _ int) string { return fileStat.Path }), V(ccCommand()))
+}
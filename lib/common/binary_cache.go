@@ -3,19 +3,27 @@ package common
 import (
 	"crypto/sha1"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	. "github.com/knaka/go-utils"
 	"github.com/samber/lo"
 	"hash"
 	"io"
+	"log"
 	"os"
+	"path/filepath"
 	"sort"
+	"time"
 )
 
 const hashNumDig = 7
 
 type BuildInfo struct {
-	Version string    `json:"version"`
-	Args    []string  `json:"args"`
+	Version string   `json:"version"`
+	Args    []string `json:"args"`
+	// Env lists the environment variables in the form of “KEY=value” which affect the build.
+	Env     []string  `json:"env,omitempty"`
 	Files   []string  `json:"files"`
 	Hash    hash.Hash `json:"-"`
 	HashStr string    `json:"hash"`
@@ -64,16 +72,38 @@ func hashStr(h hash.Hash) (hashStr string) {
 	return hex.EncodeToString(h.Sum(nil))[:hashNumDig]
 }
 
+type buildInfoOptionsT struct {
+	env []string
+}
+
+type BuildInfoOptSetterFn func(*buildInfoOptionsT)
+
+// WithEnv adds the environment variables in the form of “KEY=value” to the build information and its hash.
+func WithEnv(env []string) BuildInfoOptSetterFn {
+	return func(opts *buildInfoOptionsT) {
+		opts.env = append(opts.env, env...)
+	}
+}
+
 func NewBuildInfo(
 	version string,
 	args []string,
 	fileInfoList []*FileInfo,
+	optSetterFnS ...BuildInfoOptSetterFn,
 ) *BuildInfo {
+	options := buildInfoOptionsT{}
+	for _, optSetterFn := range optSetterFnS {
+		optSetterFn(&options)
+	}
 	hashOut := sha1.New()
 	hashOut.Write([]byte(version))
 	for _, arg := range args {
 		hashOut.Write([]byte(arg))
 	}
+	sort.Strings(options.env)
+	for _, envEntry := range options.env {
+		hashOut.Write([]byte(envEntry))
+	}
 	sort.Slice(fileInfoList, func(i, j int) bool {
 		if fileInfoList[i].Size == fileInfoList[j].Size {
 			return fileInfoList[i].HashStr < fileInfoList[j].HashStr
@@ -86,10 +116,88 @@ func NewBuildInfo(
 	return &BuildInfo{
 		Version: version,
 		Args:    args,
+		Env:     options.env,
+		// Absolute so that the sources are found from any working directory, e.g. by the pruning of the orphaned entries.
 		Files: lo.Map(fileInfoList, func(f *FileInfo, _ int) string {
-			return f.Name + ":" + f.HashStr
+			name := f.Name
+			if absName, err := filepath.Abs(name); err == nil {
+				name = absName
+			}
+			return name + ":" + f.HashStr
 		}),
 		Hash:    hashOut,
 		HashStr: hashStr(hashOut),
 	}
 }
+
+const LockFileBase = ".lock"
+
+// LastUsedFileBase is the base name of the empty file whose modification time records when the cache entry was used last.
+const LastUsedFileBase = ".last_used"
+
+// TouchLastUsed records that the cache entry is used now. Only the timestamp of a small file is updated so that the build information is not rewritten.
+func TouchLastUsed(cacheDirPath string) (err error) {
+	lastUsedFilePath := filepath.Join(cacheDirPath, LastUsedFileBase)
+	now := time.Now()
+	err = os.Chtimes(lastUsedFilePath, now, now)
+	if os.IsNotExist(err) {
+		return os.WriteFile(lastUsedFilePath, nil, 0644)
+	}
+	return err
+}
+
+// WriteFileAtomically writes the file via a temporary file so that readers never see a partially written one.
+func WriteFileAtomically(filePath string, data []byte, perm os.FileMode) (err error) {
+	defer Catch(&err)
+	tempFilePath := fmt.Sprintf("%s.tmp-%d", filePath, os.Getpid())
+	V0(os.WriteFile(tempFilePath, data, perm))
+	return os.Rename(tempFilePath, filePath)
+}
+
+// EnsureBuilt makes sure that the artifact of the build exists at the path in the cache entry, calling buildFn if it does not exist or rebuilding is requested.
+// buildFn must produce the artifact, either a file or a directory, at the temporary path given, which is then renamed into place.
+// Builds of the same cache entry are serialized with a file lock, and the processes which have waited for the lock reuse the artifact built by the other.
+func EnsureBuilt(
+	buildInfo *BuildInfo,
+	artifactPath string,
+	shouldRebuild bool,
+	buildFn func(tempPath string) error,
+) (err error) {
+	var cacheDirPath string
+	// Deferred before Catch so that it runs after a panic has been turned into the error.
+	defer (func() {
+		if err == nil {
+			Ignore(TouchLastUsed(cacheDirPath))
+		}
+	})()
+	defer Catch(&err)
+	cacheDirPath = V(CacheDirPath(buildInfo.Hash))
+	if _, err := os.Stat(artifactPath); err == nil && !shouldRebuild {
+		return nil
+	}
+	waitStartTime := time.Now()
+	V0(os.MkdirAll(cacheDirPath, 0755))
+	unlock := V(Lock(filepath.Join(cacheDirPath, LockFileBase)))
+	defer (func() { Ignore(unlock()) })()
+	if stat, err := os.Stat(artifactPath); err == nil {
+		// Built by another process while waiting for the lock.
+		if !shouldRebuild || !stat.ModTime().Before(waitStartTime) {
+			return nil
+		}
+	}
+	tempPath := fmt.Sprintf("%s.tmp-%d", artifactPath, os.Getpid())
+	V0(os.RemoveAll(tempPath))
+	defer (func() { Ignore(os.RemoveAll(tempPath)) })()
+	V0(buildFn(tempPath))
+	if stat, err := os.Stat(artifactPath); err == nil && stat.IsDir() {
+		// The old directory is renamed aside rather than removed first, so that the entry is missing only between the renames.
+		oldPath := fmt.Sprintf("%s.old-%d", artifactPath, os.Getpid())
+		V0(os.RemoveAll(oldPath))
+		V0(os.Rename(artifactPath, oldPath))
+		defer (func() { Ignore(os.RemoveAll(oldPath)) })()
+	}
+	V0(os.Rename(tempPath, artifactPath))
+	V0(WriteFileAtomically(V(InfoFilePath(buildInfo.Hash)), V(json.Marshal(buildInfo)), 0644))
+	log.Println("built:", artifactPath)
+	return nil
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Concurrent builds of the same cache entry run the build only once and all of them get the artifact.
+func TestEnsureBuilt(t *testing.T) {
+	defer SetHomeDirPath(homeDirPath)
+	SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	srcFilePath := filepath.Join(t.TempDir(), "main.go")
+	V0(os.WriteFile(srcFilePath, []byte("package main\n"), 0644))
+	buildInfo := NewBuildInfo("v1", nil, []*FileInfo{V(GetFileInfo(srcFilePath))})
+	artifactPath := V(CachedExePath(buildInfo.Hash, "main"))
+	var numBuilds atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go (func() {
+			defer wg.Done()
+			V0(EnsureBuilt(buildInfo, artifactPath, false, func(tempPath string) error {
+				numBuilds.Add(1)
+				time.Sleep(100 * time.Millisecond)
+				return os.WriteFile(tempPath, []byte("built"), 0755)
+			}))
+			assert.Equal(t, "built", string(V(os.ReadFile(artifactPath))))
+		})()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), numBuilds.Load())
+	assert.FileExists(t, V(InfoFilePath(buildInfo.Hash)))
+}
+
+// A failed build does not mark the cache entry as used.
+func TestEnsureBuiltFailure(t *testing.T) {
+	defer SetHomeDirPath(homeDirPath)
+	SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	buildInfo := NewBuildInfo("v1", []string{"failure"}, nil)
+	artifactPath := V(CachedExePath(buildInfo.Hash, "main"))
+	err := EnsureBuilt(buildInfo, artifactPath, false, func(tempPath string) error {
+		return os.ErrInvalid
+	})
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(filepath.Dir(artifactPath), LastUsedFileBase))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// Rebuilding a directory artifact replaces it and leaves the old one neither in place nor aside.
+func TestEnsureBuiltDirectory(t *testing.T) {
+	defer SetHomeDirPath(homeDirPath)
+	SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	buildInfo := NewBuildInfo("v1", []string{"directory"}, nil)
+	artifactPath := V(CachedExePath(buildInfo.Hash, "classes"))
+	for _, content := range []string{"old", "new"} {
+		V0(EnsureBuilt(buildInfo, artifactPath, true, func(tempPath string) error {
+			V0(os.MkdirAll(tempPath, 0755))
+			return os.WriteFile(filepath.Join(tempPath, content), nil, 0644)
+		}))
+	}
+	assert.NoFileExists(t, filepath.Join(artifactPath, "old"))
+	assert.FileExists(t, filepath.Join(artifactPath, "new"))
+	assert.Empty(t, V(filepath.Glob(artifactPath+".old-*")))
+}
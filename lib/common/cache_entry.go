@@ -0,0 +1,110 @@
+package common
+
+import (
+	"encoding/json"
+	. "github.com/knaka/go-utils"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CacheEntry is a directory in the cache root which holds the artifacts of a build.
+type CacheEntry struct {
+	HashStr string
+	DirPath string
+	// BuildInfo is nil if the information file is missing or broken, e.g. when the build failed.
+	BuildInfo *BuildInfo
+	// Size is the total size of the files in the entry in bytes.
+	Size int64
+	// LastUsed is the time when the entry was used last, or built if it has never been used since.
+	LastUsed time.Time
+}
+
+// SourceFilePaths returns the paths of the source files recorded in the build information.
+func (e *CacheEntry) SourceFilePaths() (filePaths []string) {
+	if e.BuildInfo == nil {
+		return nil
+	}
+	for _, file := range e.BuildInfo.Files {
+		// Each element is in the form of “path:hash”.
+		if i := strings.LastIndex(file, ":"); i >= 0 {
+			file = file[:i]
+		}
+		filePaths = append(filePaths, file)
+	}
+	return filePaths
+}
+
+// IsOrphaned checks if the entry is not usable any more: the build information is missing or any of the source files does not exist.
+// Relative paths, recorded by older versions, are not checked as they depend on the working directory of the build.
+func (e *CacheEntry) IsOrphaned() bool {
+	if e.BuildInfo == nil {
+		return true
+	}
+	for _, filePath := range e.SourceFilePaths() {
+		if !filepath.IsAbs(filePath) {
+			continue
+		}
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			return true
+		}
+	}
+	return false
+}
+
+func dirSize(dirPath string) (size int64, err error) {
+	err = filepath.WalkDir(dirPath, func(_ string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirEntry.IsDir() {
+			return nil
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+func readCacheEntry(dirPath string) (entry *CacheEntry, err error) {
+	defer Catch(&err)
+	entry = &CacheEntry{
+		HashStr: filepath.Base(dirPath),
+		DirPath: dirPath,
+		Size:    V(dirSize(dirPath)),
+	}
+	infoFilePath := filepath.Join(dirPath, InfoFileBase)
+	// Entries built before the last-used time was recorded fall back to the build time.
+	if stat, err := os.Stat(filepath.Join(dirPath, LastUsedFileBase)); err == nil {
+		entry.LastUsed = stat.ModTime()
+	} else if stat, err := os.Stat(infoFilePath); err == nil {
+		entry.LastUsed = stat.ModTime()
+	} else {
+		entry.LastUsed = V(os.Stat(dirPath)).ModTime()
+	}
+	if data, err := os.ReadFile(infoFilePath); err == nil {
+		var buildInfo BuildInfo
+		if err := json.Unmarshal(data, &buildInfo); err == nil {
+			entry.BuildInfo = &buildInfo
+		}
+	}
+	return entry, nil
+}
+
+// CacheEntries returns all the entries in the cache root directory.
+func CacheEntries(cacheRootDirPath string) (entries []*CacheEntry, err error) {
+	defer Catch(&err)
+	for _, dirEntry := range V(os.ReadDir(cacheRootDirPath)) {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		entries = append(entries, V(readCacheEntry(filepath.Join(cacheRootDirPath, dirEntry.Name()))))
+	}
+	return entries, nil
+}
@@ -0,0 +1,30 @@
+package common
+
+import (
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The sources are recorded with the absolute paths, so that the entry is not orphaned from another working directory.
+func TestIsOrphaned(t *testing.T) {
+	workDirPath := V(os.Getwd())
+	defer (func() { V0(os.Chdir(workDirPath)) })()
+	srcDirPath := t.TempDir()
+	V0(os.WriteFile(filepath.Join(srcDirPath, "main.go"), []byte("package main\n"), 0644))
+	V0(os.Chdir(srcDirPath))
+	buildInfo := NewBuildInfo("v1", nil, []*FileInfo{V(GetFileInfo("main.go"))})
+	V0(os.Chdir(t.TempDir()))
+	entry := &CacheEntry{BuildInfo: buildInfo}
+	assert.Equal(t, []string{filepath.Join(V(filepath.EvalSymlinks(srcDirPath)), "main.go")}, entry.SourceFilePaths())
+	assert.False(t, entry.IsOrphaned())
+
+	// Recorded relatively by an older version
+	entry = &CacheEntry{BuildInfo: &BuildInfo{Files: []string{"main.go:0123456"}}}
+	assert.False(t, entry.IsOrphaned())
+	V0(os.Remove(filepath.Join(srcDirPath, "main.go")))
+	entry = &CacheEntry{BuildInfo: buildInfo}
+	assert.True(t, entry.IsOrphaned())
+}
@@ -0,0 +1,159 @@
+package common
+
+import (
+	"github.com/BurntSushi/toml"
+	. "github.com/knaka/go-utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Average number of launches between cleanups
+const DefaultCleanupCycle = 100
+
+// Number of days after which a binary is considered old
+const DefaultCleanupThresholdDays = 90
+
+type CleanupConfig struct {
+	Cycle int `toml:"cycle"`
+	// ThresholdDays is the number of days after which an unused cache entry is removed.
+	ThresholdDays int `toml:"threshold_days"`
+	// MaxSize is the budget of the total size of the cache such as “2G”. The least recently used entries are removed to fit in it.
+	MaxSize string `toml:"max_size"`
+}
+
+// Config is the configuration of binc. The global one is read from “config.toml” in the configuration directory,
+// and each directory in the search path can have its own “.binc.toml”, in which only Exclude, Aliases, BuildFlags and JsRuntime are honored.
+type Config struct {
+	// Path lists the directories searched for commands in addition to $BINCPATH.
+	Path []string `toml:"path"`
+	// Exclude lists the patterns of command names which are not exposed.
+	Exclude []string `toml:"exclude"`
+	// Aliases maps alias names to command names.
+	Aliases map[string]string `toml:"aliases"`
+	// Pins maps command names to the source path or the manager name which should win when several sources provide the command.
+	Pins    map[string]string `toml:"pins"`
+	Cleanup CleanupConfig     `toml:"cleanup"`
+	// Tools maps tool names (“go”, “java”, “javac”, “scala-cli”, “scalac”, “scala_home”, “cargo”, “cabal”, “stack”, “ghc”, “python”, “cc”, …) to their paths.
+	Tools map[string]string `toml:"tools"`
+	// BuildFlags maps language names (“go”, “java”, “scala”, …) to the flags passed to their compilers.
+	BuildFlags map[string][]string `toml:"build_flags"`
+	// JsRuntime is the runtime of TypeScript and JavaScript commands without a shebang: “node”, “deno” or “bun”.
+	JsRuntime string `toml:"js_runtime"`
+	// FastPath enables launching the cached builds with the stamps recorded at the previous launches, without resolving the commands and hashing their sources.
+	FastPath bool `toml:"fast_path"`
+
+	// FilePath is the path of the configuration file, or empty if it does not exist.
+	FilePath string `toml:"-"`
+	// Keys lists the dotted keys defined in the configuration file.
+	Keys []string `toml:"-"`
+}
+
+// ConfigDirPath returns the path of the configuration directory of binc.
+func ConfigDirPath() string {
+	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
+		return filepath.Join(xdgConfigHome, "binc")
+	}
+	return filepath.Join(homeDirPath, ".config", "binc")
+}
+
+// ConfigFilePath returns the path of the global configuration file of binc.
+func ConfigFilePath() string {
+	return filepath.Join(ConfigDirPath(), "config.toml")
+}
+
+// DirConfigBase is the base name of the per-directory configuration file.
+const DirConfigBase = ".binc.toml"
+
+// ExpandHome expands the leading “~/” of the path to the home directory.
+func ExpandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(homeDirPath, path[2:])
+	}
+	return path
+}
+
+func loadConfigFile(config *Config, filePath string) (err error) {
+	defer Catch(&err)
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil
+	}
+	metaData := V(toml.DecodeFile(filePath, config))
+	config.FilePath = filePath
+	for _, key := range metaData.Keys() {
+		config.Keys = append(config.Keys, key.String())
+	}
+	return nil
+}
+
+func loadConfig() (config *Config, err error) {
+	defer Catch(&err)
+	config = &Config{
+		Cleanup: CleanupConfig{
+			Cycle:         DefaultCleanupCycle,
+			ThresholdDays: DefaultCleanupThresholdDays,
+		},
+	}
+	V0(loadConfigFile(config, ConfigFilePath()))
+	for i, dirPath := range config.Path {
+		config.Path[i] = ExpandHome(dirPath)
+	}
+	return config, nil
+}
+
+var config = sync.OnceValues(loadConfig)
+
+// GetConfig returns the global configuration, which is loaded once per process.
+func GetConfig() (*Config, error) {
+	return config()
+}
+
+var dirConfigs = map[string]*Config{}
+
+var dirConfigsMutex sync.Mutex
+
+// GetDirConfig returns the configuration of the directory in the search path.
+func GetDirConfig(dirPath string) (dirConfig *Config, err error) {
+	defer Catch(&err)
+	dirConfigsMutex.Lock()
+	defer dirConfigsMutex.Unlock()
+	if dirConfig, ok := dirConfigs[dirPath]; ok {
+		return dirConfig, nil
+	}
+	dirConfig = &Config{}
+	V0(loadConfigFile(dirConfig, filepath.Join(dirPath, DirConfigBase)))
+	dirConfigs[dirPath] = dirConfig
+	return dirConfig, nil
+}
+
+// ResetConfig discards the loaded configurations so that they are loaded again. It is intended for testing.
+func ResetConfig() {
+	config = sync.OnceValues(loadConfig)
+	dirConfigsMutex.Lock()
+	defer dirConfigsMutex.Unlock()
+	dirConfigs = map[string]*Config{}
+}
+
+// ToolPath returns the path of the tool configured in the global configuration, or an empty string if it is not configured.
+func ToolPath(name string) string {
+	config, err := GetConfig()
+	if err != nil {
+		return ""
+	}
+	return ExpandHome(config.Tools[name])
+}
+
+// BuildFlags returns the compiler flags for the language configured for the directory in the search path.
+// The per-directory configuration overrides the global one.
+func BuildFlags(language string, dirPath string) (flags []string) {
+	if config, err := GetConfig(); err == nil {
+		flags = config.BuildFlags[language]
+	}
+	if dirConfig, err := GetDirConfig(dirPath); err == nil {
+		if dirFlags, ok := dirConfig.BuildFlags[language]; ok {
+			flags = dirFlags
+		}
+	}
+	return flags
+}
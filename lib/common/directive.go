@@ -0,0 +1,43 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SplitDirectiveArgs splits the arguments of a directive by spaces, honoring single and double quotes.
+func SplitDirectiveArgs(s string) (args []string, err error) {
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New(fmt.Sprintf("unterminated quote: %s", s))
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
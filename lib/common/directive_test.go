@@ -0,0 +1,16 @@
+package common
+
+import (
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSplitDirectiveArgs(t *testing.T) {
+	assert.Equal(t,
+		[]string{"-tags", "sqlite_omit_load_extension", "-ldflags", "-s -w", "-trimpath", ""},
+		V(SplitDirectiveArgs(`-tags sqlite_omit_load_extension -ldflags "-s -w"  -trimpath ''`)),
+	)
+	_, err := SplitDirectiveArgs(`-ldflags "-s -w`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+var execEnabled = false
+
+// SetExecEnabled sets whether RunCommand may replace the current process with the command.
+// It is disabled by default so that callers such as tests are not replaced.
+func SetExecEnabled(enabled bool) {
+	execEnabled = enabled
+}
+
+// canExec checks if the command can replace the current process, which requires the standard streams to be inherited as they are.
+func canExec(cmd *exec.Cmd) bool {
+	return execEnabled &&
+		cmd.Err == nil &&
+		cmd.Stdin == os.Stdin &&
+		cmd.Stdout == os.Stdout &&
+		cmd.Stderr == os.Stderr &&
+		len(cmd.ExtraFiles) == 0 &&
+		cmd.SysProcAttr == nil
+}
+
+// RunCommand runs the target command of a manager. When enabled and possible, the command replaces the current process
+// and RunCommand does not return on success. Otherwise, the command runs as a child process, to which the signals sent to
+// this process are forwarded.
+func RunCommand(cmd *exec.Cmd) (err error) {
+	if canExec(cmd) {
+		// Falls back to a child process if replacing the process fails.
+		_ = execCommand(cmd)
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	signals := make(chan os.Signal, 1)
+	// Notify() without signals would relay all the incoming signals.
+	if handledSignals := append(ignoredSignals, forwardedSignals...); len(handledSignals) > 0 {
+		signal.Notify(signals, handledSignals...)
+	}
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	defer close(done)
+	go (func() {
+		for {
+			select {
+			case sig := <-signals:
+				if isForwarded(sig) {
+					_ = cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	})()
+	return cmd.Wait()
+}
+
+func isForwarded(sig os.Signal) bool {
+	for _, forwarded := range forwardedSignals {
+		if sig == forwarded {
+			return true
+		}
+	}
+	return false
+}
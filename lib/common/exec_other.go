@@ -0,0 +1,25 @@
+//go:build !unix
+
+package common
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+var ignoredSignals = []os.Signal{
+	os.Interrupt,
+}
+
+var forwardedSignals []os.Signal
+
+// execCommand is not supported on this platform, so the command always runs as a child process.
+func execCommand(_ *exec.Cmd) error {
+	return errors.New("replacing the process is not supported")
+}
+
+// ExitAs exits the current process with the exit code of the child process.
+func ExitAs(exitError *exec.ExitError) {
+	os.Exit(exitError.ExitCode())
+}
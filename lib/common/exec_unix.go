@@ -0,0 +1,61 @@
+//go:build unix
+
+package common
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// The signals generated by the terminal reach the child process too, as it is in the same foreground process group.
+// Only the parent survives them until the child exits.
+var ignoredSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+}
+
+// The signals which are typically sent to the process explicitly.
+var forwardedSignals = []os.Signal{
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// execCommand replaces the current process with the command.
+func execCommand(cmd *exec.Cmd) (err error) {
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	if cmd.Dir != "" {
+		workDirPath, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		if err = os.Chdir(cmd.Dir); err != nil {
+			return err
+		}
+		// The command runs as a child process from the original directory if the exec fails.
+		defer (func() { _ = os.Chdir(workDirPath) })()
+	}
+	return syscall.Exec(cmd.Path, cmd.Args, env)
+}
+
+// ExitAs exits the current process in the same way as the child process exited. If the child was killed by a signal,
+// the current process is killed by the same signal so that the caller can tell it.
+func ExitAs(exitError *exec.ExitError) {
+	var waitStatus syscall.WaitStatus
+	if status, ok := exitError.Sys().(syscall.WaitStatus); ok {
+		waitStatus = status
+	}
+	if waitStatus.Signaled() {
+		sig := waitStatus.Signal()
+		signal.Reset(sig)
+		_ = syscall.Kill(os.Getpid(), sig)
+		os.Exit(128 + int(sig))
+	}
+	os.Exit(exitError.ExitCode())
+}
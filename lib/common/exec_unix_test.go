@@ -0,0 +1,21 @@
+//go:build unix
+
+package common
+
+import (
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// A failed exec leaves the working directory as it was, so that the command can run as a child process instead.
+func TestExecCommandFailure(t *testing.T) {
+	workDirPath := V(os.Getwd())
+	cmd := exec.Command(filepath.Join(t.TempDir(), "missing"))
+	cmd.Dir = t.TempDir()
+	assert.Error(t, execCommand(cmd))
+	assert.Equal(t, workDirPath, V(os.Getwd()))
+}
@@ -0,0 +1,24 @@
+package common
+
+import (
+	. "github.com/knaka/go-utils"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// InstallFakeTool puts the shell script as the tool on $PATH for the test and returns its path. The builds go to the cache
+// in a home directory of the test. The test is skipped on Windows, which does not run shell scripts. It is intended for testing.
+func InstallFakeTool(t testing.TB, name string, script string) (toolPath string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("no shell scripts")
+	}
+	binDirPath := t.TempDir()
+	toolPath = filepath.Join(binDirPath, name)
+	V0(os.WriteFile(toolPath, []byte(script), 0755))
+	t.Setenv("PATH", binDirPath+string(os.PathListSeparator)+os.Getenv("PATH"))
+	SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	return toolPath
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package common
+
+import (
+	"os"
+)
+
+// inode returns zero as inode numbers are not available on this platform, in which case sizes and modification times are compared only.
+func inode(_ os.FileInfo) uint64 {
+	return 0
+}
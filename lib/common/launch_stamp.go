@@ -0,0 +1,137 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/knaka/go-utils"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStat is the state of a file or a directory which can be obtained without reading its content.
+type FileStat struct {
+	Path string `json:"path"`
+	// Size is -1 if the file does not exist, so that its creation is noticed as well.
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+	Inode   uint64 `json:"inode"`
+}
+
+func GetFileStat(filePath string) *FileStat {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return &FileStat{Path: filePath, Size: -1}
+	}
+	return &FileStat{
+		Path:    filePath,
+		Size:    Ternary(stat.IsDir(), 0, stat.Size()),
+		ModTime: stat.ModTime().UnixNano(),
+		Inode:   inode(stat),
+	}
+}
+
+// LaunchStamp records the command line of a cached build of a command and what it depends on,
+// so that later launches can skip resolving the command and hashing its sources while nothing has changed.
+type LaunchStamp struct {
+	// Command is the command line to launch the cached build, to which the arguments are appended.
+	Command    []string    `json:"command"`
+	CachedPath string      `json:"cached_path"`
+	Files      []*FileStat `json:"files"`
+	// Env maps the names of the environment variables which affect the build to their values, where unset ones are empty.
+	Env map[string]string `json:"env"`
+}
+
+// FastLauncher is implemented by the managers whose commands can be launched with a stamp.
+type FastLauncher interface {
+	// LaunchStamp builds the command if necessary and returns the stamp to launch it.
+	// ErrNoLaunchStamp is returned for the commands which cannot be launched with a stamp.
+	LaunchStamp(cmdBase string, shouldRebuild bool) (*LaunchStamp, error)
+}
+
+// ErrNoLaunchStamp tells that the command has to be run by its manager rather than with a stamp.
+var ErrNoLaunchStamp = errors.New("no launch stamp")
+
+// NewLaunchStamp creates a stamp depending on the source files in the build information, the directories containing them,
+// the extra files such as compilers, and the environment variables.
+func NewLaunchStamp(command []string, cachedPath string, buildInfo *BuildInfo, envNames []string, extraFilePaths ...string) *LaunchStamp {
+	stamp := &LaunchStamp{
+		Command:    command,
+		CachedPath: cachedPath,
+		Env:        map[string]string{},
+	}
+	var filePaths []string
+	dirPaths := map[string]bool{}
+	for _, file := range buildInfo.Files {
+		// Each element is in the form of “path:hash”.
+		if i := strings.LastIndex(file, ":"); i >= 0 {
+			file = file[:i]
+		}
+		filePaths = append(filePaths, file)
+		dirPaths[filepath.Dir(file)] = true
+	}
+	// Files added to the directories can change the build, e.g. another file of a package.
+	for dirPath := range dirPaths {
+		filePaths = append(filePaths, dirPath)
+	}
+	stamp.AddFiles(append(filePaths, extraFilePaths...)...)
+	stamp.AddEnv(envNames...)
+	return stamp
+}
+
+// AddFiles adds the current states of the files to the dependencies of the stamp.
+func (s *LaunchStamp) AddFiles(filePaths ...string) {
+	for _, filePath := range filePaths {
+		s.Files = append(s.Files, GetFileStat(filePath))
+	}
+}
+
+// AddEnv adds the current values of the environment variables to the dependencies of the stamp.
+func (s *LaunchStamp) AddEnv(envNames ...string) {
+	for _, envName := range envNames {
+		s.Env[envName] = os.Getenv(envName)
+	}
+}
+
+// IsValid checks if the cached build still exists and none of the files and the environment variables has changed.
+func (s *LaunchStamp) IsValid() bool {
+	if len(s.Command) == 0 {
+		return false
+	}
+	if _, err := os.Stat(s.CachedPath); err != nil {
+		return false
+	}
+	for envName, value := range s.Env {
+		if os.Getenv(envName) != value {
+			return false
+		}
+	}
+	for _, fileStat := range s.Files {
+		if *GetFileStat(fileStat.Path) != *fileStat {
+			return false
+		}
+	}
+	return true
+}
+
+// StampsDirPath returns the path of the directory which holds the launch stamps of the commands.
+func StampsDirPath() (dirPath string, err error) {
+	defer Catch(&err)
+	return filepath.Join(V(LinksDirPath()), ".stamps"), nil
+}
+
+// LoadLaunchStamp reads the launch stamp of the command.
+func LoadLaunchStamp(name string) (stamp *LaunchStamp, err error) {
+	defer Catch(&err)
+	stamp = &LaunchStamp{}
+	V0(json.Unmarshal(V(os.ReadFile(filepath.Join(V(StampsDirPath()), name+".json"))), stamp))
+	return stamp, nil
+}
+
+// SaveLaunchStamp writes the launch stamp of the command.
+func SaveLaunchStamp(name string, stamp *LaunchStamp) (err error) {
+	defer Catch(&err)
+	stampsDirPath := V(StampsDirPath())
+	V0(os.MkdirAll(stampsDirPath, 0755))
+	return WriteFileAtomically(filepath.Join(stampsDirPath, name+".json"), V(json.Marshal(stamp)), 0644)
+}
@@ -0,0 +1,45 @@
+package common
+
+import (
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The stamp is invalidated by a change of the sources, a file added next to them, a change of the environment, or the loss of the cached build.
+func TestLaunchStamp(t *testing.T) {
+	defer SetHomeDirPath(homeDirPath)
+	SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	srcDirPath := t.TempDir()
+	srcFilePath := filepath.Join(srcDirPath, "main.go")
+	V0(os.WriteFile(srcFilePath, []byte("package main\n"), 0644))
+	cachedPath := filepath.Join(t.TempDir(), "main")
+	V0(os.WriteFile(cachedPath, nil, 0755))
+	buildInfo := NewBuildInfo("v1", nil, []*FileInfo{V(GetFileInfo(srcFilePath))})
+	t.Setenv("BINC_TEST_ENV", "foo")
+	newStamp := func() *LaunchStamp {
+		stamp := NewLaunchStamp([]string{cachedPath}, cachedPath, buildInfo, []string{"BINC_TEST_ENV"})
+		V0(SaveLaunchStamp("main", stamp))
+		return V(LoadLaunchStamp("main"))
+	}
+
+	assert.True(t, newStamp().IsValid())
+
+	stamp := newStamp()
+	V0(os.WriteFile(srcFilePath, []byte("package main\n\nfunc main() {}\n"), 0644))
+	assert.False(t, stamp.IsValid())
+
+	stamp = newStamp()
+	V0(os.WriteFile(filepath.Join(srcDirPath, "sub.go"), []byte("package main\n"), 0644))
+	assert.False(t, stamp.IsValid())
+
+	stamp = newStamp()
+	t.Setenv("BINC_TEST_ENV", "bar")
+	assert.False(t, stamp.IsValid())
+
+	stamp = newStamp()
+	V0(os.Remove(cachedPath))
+	assert.False(t, stamp.IsValid())
+}
@@ -0,0 +1,21 @@
+package common
+
+import (
+	. "github.com/knaka/go-utils"
+	"os"
+)
+
+// Lock acquires an exclusive lock associated with the path, blocking until it is available.
+// The returned function releases the lock.
+func Lock(lockFilePath string) (unlock func() error, err error) {
+	defer Catch(&err)
+	file := V(os.OpenFile(lockFilePath, os.O_CREATE|os.O_RDWR, 0644))
+	if err := lockFile(file); err != nil {
+		Ignore(file.Close())
+		return nil, err
+	}
+	return func() error {
+		defer (func() { Ignore(file.Close()) })()
+		return unlockFile(file)
+	}, nil
+}
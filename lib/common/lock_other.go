@@ -0,0 +1,36 @@
+//go:build !unix
+
+package common
+
+import (
+	"os"
+	"time"
+)
+
+const lockPollInterval = 100 * time.Millisecond
+
+// Locks older than this are considered to be left by crashed processes.
+const staleLockDuration = 10 * time.Minute
+
+// lockFile acquires an exclusive lock by creating a marker file next to the file, blocking until it is available.
+func lockFile(file *os.File) error {
+	markerPath := file.Name() + ".held"
+	for {
+		marker, err := os.OpenFile(markerPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			return marker.Close()
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		if stat, err := os.Stat(markerPath); err == nil && time.Since(stat.ModTime()) > staleLockDuration {
+			_ = os.Remove(markerPath)
+			continue
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+func unlockFile(file *os.File) error {
+	return os.Remove(file.Name() + ".held")
+}
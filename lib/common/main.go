@@ -21,14 +21,24 @@ type Factory struct {
 
 var factories []*Factory
 
-// Factories returns a list of factories in descending order of priority weight.
+// Factories returns a list of factories in descending order of priority weight. Factories with the same weight are in the order of registration.
 func Factories() []*Factory {
-	sort.Slice(factories, func(i, j int) bool {
+	sort.SliceStable(factories, func(i, j int) bool {
 		return factories[i].PriorityWeight > factories[j].PriorityWeight
 	})
 	return factories
 }
 
+// FactoryByName returns the factory registered with the name, or nil if there is none.
+func FactoryByName(name string) *Factory {
+	for _, factory := range factories {
+		if factory.Name == name {
+			return factory
+		}
+	}
+	return nil
+}
+
 func RegisterManagerFactory(name string, fn NewManagerFn, priorityWeight int) {
 	factories = append(factories, &Factory{
 		Name:           name,
@@ -48,6 +58,17 @@ type Manager interface {
 	Run(args []string, shouldRebuild bool) error
 }
 
+// Builder is implemented by the managers which can build commands ahead of time without running them.
+type Builder interface {
+	Build(cmdBase string, shouldRebuild bool) error
+}
+
+// CacheChecker is implemented by the managers which build commands into the cache.
+type CacheChecker interface {
+	// CachedPath returns the path of the cached build of the command for the current sources, whether it exists or not.
+	CachedPath(cmdBase string) (cachedPath string, err error)
+}
+
 func CacheRootDirPath() (cacheRootDirPath string, err error) {
 	defer Catch(&err)
 	cacheRootDirPath = filepath.Join(V(LinksDirPath()), ".cache")
@@ -55,13 +76,13 @@ func CacheRootDirPath() (cacheRootDirPath string, err error) {
 	return cacheRootDirPath, nil
 }
 
+// CacheDirPath returns the path of the cache entry directory for the hash. The directory is not created, so that the existence of a cached build can be checked without side effects.
 func CacheDirPath(h hash.Hash) (dir string, err error) {
 	defer Catch(&err)
 	dir = filepath.Join(
 		V(CacheRootDirPath()),
 		hashStr(h),
 	)
-	V0(os.MkdirAll(dir, 0755))
 	return dir, nil
 }
 
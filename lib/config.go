@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"text/tabwriter"
+)
+
+// configEntryT is a value of the effective configuration with where it came from.
+type configEntryT struct {
+	Key    string
+	Value  any
+	Origin string
+}
+
+// Environment variables which take precedence over the configuration.
+var configEnvNames = []string{
+	"BINCPATH",
+	"BUILD",
+	"REBUILD",
+	"GOROOT",
+	"SCALA_HOME",
+	"XDG_CONFIG_HOME",
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configEntries flattens the configuration into entries. Values which are not defined in the file are omitted unless they have defaults.
+func configEntries(config *common.Config, withDefaults bool) (entries []*configEntryT) {
+	origin := func(key string) string {
+		if slices.Contains(config.Keys, key) {
+			return config.FilePath
+		}
+		return "default"
+	}
+	for _, dirPath := range config.Path {
+		entries = append(entries, &configEntryT{"path", dirPath, origin("path")})
+	}
+	if len(config.Exclude) > 0 {
+		entries = append(entries, &configEntryT{"exclude", config.Exclude, origin("exclude")})
+	}
+	for _, key := range sortedKeys(config.Aliases) {
+		entries = append(entries, &configEntryT{"aliases." + key, config.Aliases[key], origin("aliases." + key)})
+	}
+	for _, key := range sortedKeys(config.Pins) {
+		entries = append(entries, &configEntryT{"pins." + key, config.Pins[key], origin("pins." + key)})
+	}
+	if withDefaults || slices.Contains(config.Keys, "cleanup.cycle") {
+		entries = append(entries, &configEntryT{"cleanup.cycle", config.Cleanup.Cycle, origin("cleanup.cycle")})
+	}
+	if withDefaults || slices.Contains(config.Keys, "cleanup.threshold_days") {
+		entries = append(entries, &configEntryT{"cleanup.threshold_days", config.Cleanup.ThresholdDays, origin("cleanup.threshold_days")})
+	}
+	if config.Cleanup.MaxSize != "" {
+		entries = append(entries, &configEntryT{"cleanup.max_size", config.Cleanup.MaxSize, origin("cleanup.max_size")})
+	}
+	for _, key := range sortedKeys(config.Tools) {
+		entries = append(entries, &configEntryT{"tools." + key, config.Tools[key], origin("tools." + key)})
+	}
+	for _, key := range sortedKeys(config.BuildFlags) {
+		entries = append(entries, &configEntryT{"build_flags." + key, config.BuildFlags[key], origin("build_flags." + key)})
+	}
+	if config.JsRuntime != "" {
+		entries = append(entries, &configEntryT{"js_runtime", config.JsRuntime, origin("js_runtime")})
+	}
+	if withDefaults || slices.Contains(config.Keys, "fast_path") {
+		entries = append(entries, &configEntryT{"fast_path", config.FastPath, origin("fast_path")})
+	}
+	return entries
+}
+
+// showConfig prints the effective configuration: the environment variables in effect, the global configuration and the per-directory ones.
+func showConfig(out io.Writer) (err error) {
+	defer Catch(&err)
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	printEntries := func(entries []*configEntryT) {
+		for _, entry := range entries {
+			value := string(V(json.Marshal(entry.Value)))
+			V0(fmt.Fprintf(writer, "%s = %s\t# %s\n", entry.Key, value, entry.Origin))
+		}
+	}
+	var envEntries []*configEntryT
+	for _, name := range configEnvNames {
+		if value, ok := os.LookupEnv(name); ok {
+			envEntries = append(envEntries, &configEntryT{"env." + name, value, "environment"})
+		}
+	}
+	printEntries(envEntries)
+	V0(fmt.Fprintf(writer, "# Global configuration: %s\n", common.ConfigFilePath()))
+	printEntries(configEntries(V(common.GetConfig()), true))
+	for _, dirPath := range bincDirPaths() {
+		dirConfig := V(common.GetDirConfig(dirPath))
+		if dirConfig.FilePath == "" {
+			continue
+		}
+		V0(fmt.Fprintf(writer, "# Directory configuration: %s\n", dirPath))
+		printEntries(configEntries(dirConfig, false))
+	}
+	return writer.Flush()
+}
+
+func configCommand(args []string, out io.Writer) (err error) {
+	if len(args) == 0 {
+		return errors.New("no config subcommand specified")
+	}
+	switch args[0] {
+	case "show":
+		return showConfig(out)
+	}
+	return errors.New(fmt.Sprintf("unknown config subcommand: %s", args[0]))
+}
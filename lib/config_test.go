@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"bytes"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	common.ResetConfig()
+	defer common.ResetConfig()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("BINCPATH", "")
+	dirPath := filepath.Join(t.TempDir(), "bin")
+	V0(os.MkdirAll(dirPath, 0755))
+	for _, base := range []string{"hello.go", "goodbye.go", "secret.go"} {
+		V0(os.WriteFile(filepath.Join(dirPath, base), []byte("package main\n\nfunc main() {}\n"), 0644))
+	}
+	V0(os.MkdirAll(common.ConfigDirPath(), 0755))
+	V0(os.WriteFile(common.ConfigFilePath(), []byte(`
+path = ["`+dirPath+`"]
+exclude = ["good*"]
+
+[aliases]
+hi = "hello"
+
+[cleanup]
+cycle = 10
+`), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, common.DirConfigBase), []byte(`
+exclude = ["secret"]
+
+[build_flags]
+go = ["-trimpath"]
+`), 0644))
+
+	resolutions := V(resolveAll())
+	assert.Len(t, resolutions, 1)
+	assert.Equal(t, "hello", resolutions[0].Name)
+	assert.Equal(t, "hello", V(resolveCommandOrAlias("hi")).Name)
+	assert.Equal(t, []string{"-trimpath"}, common.BuildFlags("go", dirPath))
+	assert.Equal(t, 10, V(common.GetConfig()).Cleanup.Cycle)
+
+	var buf bytes.Buffer
+	V0(showConfig(&buf))
+	output := buf.String()
+	assert.Regexp(t, `aliases.hi = "hello" +# `+common.ConfigFilePath(), output)
+	assert.Regexp(t, `cleanup.cycle = 10 +# `+common.ConfigFilePath(), output)
+	assert.Regexp(t, `cleanup.threshold_days = 90 +# default`, output)
+	assert.Regexp(t, `build_flags.go = \["-trimpath"\] +# `+filepath.Join(dirPath, common.DirConfigBase), output)
+}
@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	. "github.com/knaka/go-utils"
+	"io"
+	"text/tabwriter"
+)
+
+type conflictSourceT struct {
+	Manager    string `json:"manager"`
+	SourcePath string `json:"source_path"`
+}
+
+type conflictT struct {
+	Name     string             `json:"name"`
+	Active   *conflictSourceT   `json:"active"`
+	Pinned   bool               `json:"pinned"`
+	Shadowed []*conflictSourceT `json:"shadowed"`
+}
+
+func newConflictSource(candidate *candidateT) *conflictSourceT {
+	return &conflictSourceT{
+		Manager:    candidate.Factory.Name,
+		SourcePath: candidate.SourcePath,
+	}
+}
+
+// conflicts prints every command which is provided by more than one source, with the active one and the shadowed ones.
+func conflicts(args []string, out io.Writer) (err error) {
+	defer Catch(&err)
+	flags := flag.NewFlagSet("conflicts", flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "output in JSON")
+	V0(flags.Parse(args))
+	conflictList := []*conflictT{}
+	for _, resolution := range V(resolveAll()) {
+		if len(resolution.Shadowed) == 0 {
+			continue
+		}
+		conflict := &conflictT{
+			Name:   resolution.Name,
+			Active: newConflictSource(resolution.Winner),
+			Pinned: resolution.Pinned,
+		}
+		for _, shadowed := range resolution.Shadowed {
+			conflict.Shadowed = append(conflict.Shadowed, newConflictSource(shadowed))
+		}
+		conflictList = append(conflictList, conflict)
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(conflictList)
+	}
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	V0(fmt.Fprintln(writer, "NAME\tSTATUS\tMANAGER\tSOURCE"))
+	for _, conflict := range conflictList {
+		V0(fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n",
+			conflict.Name,
+			Ternary(conflict.Pinned, "pinned", "active"),
+			conflict.Active.Manager,
+			conflict.Active.SourcePath,
+		))
+		for _, shadowed := range conflict.Shadowed {
+			V0(fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n",
+				conflict.Name,
+				"shadowed",
+				shadowed.Manager,
+				shadowed.SourcePath,
+			))
+		}
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,300 @@
+package golang
+
+import (
+	"bufio"
+	"errors"
+	. "github.com/knaka/go-utils"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// localModules maps module paths to the directories on the local file system which provide them.
+type localModules map[string]string
+
+// dirForImport returns the local directory of the package with the given import path, if the package belongs to one of the local modules.
+func (mods localModules) dirForImport(importPath string) (dirPath string, ok bool) {
+	longest := ""
+	for modPath := range mods {
+		if importPath != modPath && !strings.HasPrefix(importPath, modPath+"/") {
+			continue
+		}
+		if len(modPath) > len(longest) {
+			longest = modPath
+		}
+	}
+	if longest == "" {
+		return "", false
+	}
+	rest := strings.TrimPrefix(importPath, longest)
+	return filepath.Join(mods[longest], filepath.FromSlash(strings.TrimPrefix(rest, "/"))), true
+}
+
+// modFileDirectives holds the directives of go.mod or go.work which binc is interested in.
+type modFileDirectives struct {
+	module   string
+	uses     []string
+	replaces map[string]string
+}
+
+// isLocalPath reports whether the replacement path of a `replace` directive refers to a local directory.
+func isLocalPath(path string) bool {
+	return filepath.IsAbs(path) ||
+		strings.HasPrefix(path, "./") ||
+		strings.HasPrefix(path, "../") ||
+		path == "." || path == ".."
+}
+
+func unquote(s string) string {
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	return s
+}
+
+// parseModFile reads the `module`, `use` and local `replace` directives of a go.mod or go.work file.
+func parseModFile(modFilePath string) (directives *modFileDirectives, err error) {
+	defer Catch(&err)
+	in := V(os.Open(modFilePath))
+	defer (func() { Ignore(in.Close()) })()
+	dirPath := filepath.Dir(modFilePath)
+	directives = &modFileDirectives{
+		replaces: map[string]string{},
+	}
+	block := ""
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+		switch fields[0] {
+		case "module":
+			if len(fields) >= 2 {
+				directives.module = unquote(fields[1])
+			}
+		case "use":
+			if len(fields) >= 2 {
+				directives.uses = append(directives.uses, filepath.Join(dirPath, unquote(fields[1])))
+			}
+		case "replace":
+			arrow := slices.Index(fields, "=>")
+			if arrow < 2 || arrow+1 >= len(fields) {
+				continue
+			}
+			newPath := unquote(fields[arrow+1])
+			if !isLocalPath(newPath) {
+				continue
+			}
+			if !filepath.IsAbs(newPath) {
+				newPath = filepath.Join(dirPath, newPath)
+			}
+			directives.replaces[unquote(fields[1])] = newPath
+		}
+	}
+	V0(scanner.Err())
+	return directives, nil
+}
+
+// findGoWorkFile finds the go.work file which is in effect for the given directory, honoring $GOWORK.
+func findGoWorkFile(initialDirPath string) (goWorkPath string, err error) {
+	switch goWork := os.Getenv("GOWORK"); goWork {
+	case "off":
+		return "", errors.New("workspace mode is disabled")
+	case "":
+	default:
+		return goWork, nil
+	}
+	dirPath := initialDirPath
+	for {
+		goWorkPath = filepath.Join(dirPath, "go.work")
+		if stat, err := os.Stat(goWorkPath); err == nil && !stat.IsDir() {
+			return goWorkPath, nil
+		}
+		parentDirPath := filepath.Dir(dirPath)
+		if parentDirPath == dirPath {
+			return "", errors.New("go.work not found")
+		}
+		dirPath = parentDirPath
+	}
+}
+
+// addModule registers the module rooted at the given directory and its local replacements.
+func (mods localModules) addModule(modDirPath string, modFilePaths *[]string) (err error) {
+	defer Catch(&err)
+	goModPath := filepath.Join(modDirPath, "go.mod")
+	directives := V(parseModFile(goModPath))
+	*modFilePaths = append(*modFilePaths, goModPath)
+	if directives.module != "" {
+		if _, ok := mods[directives.module]; ok {
+			return nil
+		}
+		mods[directives.module] = modDirPath
+	}
+	for modPath, replaceDirPath := range directives.replaces {
+		if _, ok := mods[modPath]; ok {
+			continue
+		}
+		mods[modPath] = replaceDirPath
+		Ignore(mods.addModule(replaceDirPath, modFilePaths))
+	}
+	return nil
+}
+
+// goSourceFiles returns the non-test Go source files in the directory.
+func goSourceFiles(dirPath string) (filePaths []string, err error) {
+	defer Catch(&err)
+	for _, filePath := range V(filepath.Glob(filepath.Join(dirPath, "*"+goExt))) {
+		if strings.HasSuffix(filePath, "_test"+goExt) {
+			continue
+		}
+		filePaths = append(filePaths, filePath)
+	}
+	return filePaths, nil
+}
+
+// embedPatternsOfFile returns the patterns of the “//go:embed” directives in the source file.
+func embedPatternsOfFile(filePath string) (patterns []string, err error) {
+	defer Catch(&err)
+	for _, line := range strings.Split(string(V(os.ReadFile(filePath))), "\n") {
+		rest, found := strings.CutPrefix(strings.TrimSpace(line), "//go:embed ")
+		if !found {
+			continue
+		}
+		for _, pattern := range strings.Fields(rest) {
+			patterns = append(patterns, unquote(pattern))
+		}
+	}
+	return patterns, nil
+}
+
+// embedFiles returns the files which the “//go:embed” patterns relative to the directory match. The files in a matched directory
+// are included recursively except the ones whose names begin with “.” or “_”, unless the pattern is prefixed with “all:”.
+func embedFiles(dirPath string, patterns []string) (filePaths []string, err error) {
+	defer Catch(&err)
+	for _, pattern := range patterns {
+		pattern, all := strings.CutPrefix(pattern, "all:")
+		for _, matchPath := range V(filepath.Glob(filepath.Join(dirPath, filepath.FromSlash(pattern)))) {
+			V0(filepath.WalkDir(matchPath, func(path string, dirEntry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if path != matchPath && !all && (strings.HasPrefix(dirEntry.Name(), ".") || strings.HasPrefix(dirEntry.Name(), "_")) {
+					return Ternary(dirEntry.IsDir(), filepath.SkipDir, nil)
+				}
+				if !dirEntry.IsDir() {
+					filePaths = append(filePaths, path)
+				}
+				return nil
+			}))
+		}
+	}
+	return filePaths, nil
+}
+
+// nonGoFiles returns the files other than the Go sources which the package builds with: the embedded files and the cgo sources.
+func nonGoFiles(dirPath string, pkg *build.Package) (filePaths []string, err error) {
+	defer Catch(&err)
+	filePaths = V(embedFiles(dirPath, pkg.EmbedPatterns))
+	for _, names := range [][]string{pkg.CFiles, pkg.CXXFiles, pkg.HFiles, pkg.SFiles} {
+		for _, name := range names {
+			filePaths = append(filePaths, filepath.Join(dirPath, name))
+		}
+	}
+	return filePaths, nil
+}
+
+// buildFilePaths returns all the local files which affect the build of the main file or the main package directory:
+// the sources, the embedded files and the cgo sources of every local (in-module, `replace`d or workspace) package the command
+// transitively imports, and the go.mod, go.sum, go.work and go.work.sum files involved.
+func buildFilePaths(goTargetPath string) (filePaths []string, err error) {
+	defer Catch(&err)
+	mods := localModules{}
+	var modFilePaths []string
+	targetDirPath := goTargetPath
+	if stat := V(os.Stat(goTargetPath)); !stat.IsDir() {
+		targetDirPath = filepath.Dir(goTargetPath)
+	}
+	if goModFilePath, err := findGoModFile(targetDirPath); err == nil {
+		V0(mods.addModule(filepath.Dir(goModFilePath), &modFilePaths))
+	}
+	if goWorkFilePath, err := findGoWorkFile(targetDirPath); err == nil {
+		directives := V(parseModFile(goWorkFilePath))
+		modFilePaths = append(modFilePaths, goWorkFilePath)
+		for _, useDirPath := range directives.uses {
+			Ignore(mods.addModule(useDirPath, &modFilePaths))
+		}
+		for modPath, replaceDirPath := range directives.replaces {
+			mods[modPath] = replaceDirPath
+		}
+	}
+	for _, modFilePath := range modFilePaths {
+		filePaths = append(filePaths, modFilePath)
+		sumFilePath := filepath.Join(filepath.Dir(modFilePath), "go.sum")
+		if filepath.Base(modFilePath) == "go.work" {
+			sumFilePath = modFilePath + ".sum"
+		}
+		if stat, err := os.Stat(sumFilePath); err == nil && !stat.IsDir() {
+			filePaths = append(filePaths, sumFilePath)
+		}
+	}
+	// The cgo sources are listed even where cgo is disabled by default, e.g. without a C compiler.
+	buildContext := build.Default
+	buildContext.CgoEnabled = true
+	visited := map[string]bool{}
+	var queue []string
+	if targetDirPath == goTargetPath {
+		queue = append(queue, goTargetPath)
+	} else {
+		filePaths = append(filePaths, goTargetPath)
+		filePaths = append(filePaths, V(embedFiles(targetDirPath, V(embedPatternsOfFile(goTargetPath))))...)
+		file := V(parser.ParseFile(token.NewFileSet(), goTargetPath, nil, parser.ImportsOnly))
+		for _, importSpec := range file.Imports {
+			if dirPath, ok := mods.dirForImport(unquote(importSpec.Path.Value)); ok {
+				queue = append(queue, dirPath)
+			}
+		}
+	}
+	for len(queue) > 0 {
+		dirPath := queue[0]
+		queue = queue[1:]
+		if visited[dirPath] {
+			continue
+		}
+		visited[dirPath] = true
+		filePaths = append(filePaths, V(goSourceFiles(dirPath))...)
+		pkg, err := buildContext.ImportDir(dirPath, 0)
+		if err != nil {
+			continue
+		}
+		filePaths = append(filePaths, V(nonGoFiles(dirPath, pkg))...)
+		for _, importPath := range pkg.Imports {
+			if dirPath, ok := mods.dirForImport(importPath); ok {
+				queue = append(queue, dirPath)
+			}
+		}
+	}
+	sort.Strings(filePaths)
+	return slices.Compact(filePaths), nil
+}
@@ -0,0 +1,88 @@
+package golang
+
+import (
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildFilePaths(t *testing.T) {
+	prjDirPath := V(filepath.Abs(filepath.Join("testdata", "prj")))
+	filePaths := V(buildFilePaths(filepath.Join(prjDirPath, "cmd", "greet")))
+	assert.Equal(t, []string{
+		filepath.Join(prjDirPath, "cmd", "greet", "main.go"),
+		filepath.Join(prjDirPath, "go.mod"),
+		filepath.Join(prjDirPath, "internal", "greeting", "greeting.go"),
+		filepath.Join(prjDirPath, "internal", "names", "names.go"),
+	}, filePaths)
+	filePaths = V(buildFilePaths(filepath.Join(prjDirPath, "cmd", "say_hello.go")))
+	assert.Equal(t, []string{
+		filepath.Join(prjDirPath, "cmd", "say_hello.go"),
+		filepath.Join(prjDirPath, "go.mod"),
+	}, filePaths)
+}
+
+func TestParseModFile(t *testing.T) {
+	dirPath := t.TempDir()
+	goModPath := filepath.Join(dirPath, "go.mod")
+	V0(os.WriteFile(goModPath, []byte(`module example.com/foo // comment
+
+go 1.21
+
+require example.com/bar v1.0.0
+
+replace example.com/bar => ../bar
+
+replace (
+	example.com/baz v1.2.3 => ./baz
+	example.com/qux => example.com/quux v1.0.0
+)
+`), 0644))
+	directives := V(parseModFile(goModPath))
+	assert.Equal(t, "example.com/foo", directives.module)
+	assert.Equal(t, map[string]string{
+		"example.com/bar": filepath.Join(filepath.Dir(dirPath), "bar"),
+		"example.com/baz": filepath.Join(dirPath, "baz"),
+	}, directives.replaces)
+}
+
+// The embedded files and the cgo sources of the packages affect the build as well.
+func TestBuildFilePathsNonGoFiles(t *testing.T) {
+	prjDirPath := t.TempDir()
+	V0(os.WriteFile(filepath.Join(prjDirPath, "go.mod"), []byte("module example.com/prj\n\ngo 1.21\n"), 0644))
+	cmdDirPath := filepath.Join(prjDirPath, "greet")
+	V0(os.MkdirAll(filepath.Join(cmdDirPath, "static", "_drafts"), 0755))
+	V0(os.WriteFile(filepath.Join(cmdDirPath, "main.go"), []byte(`package main
+
+// #include "greet.h"
+import "C"
+
+import "embed"
+
+//go:embed greeting.txt static
+var files embed.FS
+
+func main() {}
+`), 0644))
+	for _, base := range []string{"greeting.txt", "greet.c", "greet.h", filepath.Join("static", "index.html"), filepath.Join("static", ".hidden"), filepath.Join("static", "_drafts", "draft.html")} {
+		V0(os.WriteFile(filepath.Join(cmdDirPath, base), nil, 0644))
+	}
+	assert.Equal(t, []string{
+		filepath.Join(prjDirPath, "go.mod"),
+		filepath.Join(cmdDirPath, "greet.c"),
+		filepath.Join(cmdDirPath, "greet.h"),
+		filepath.Join(cmdDirPath, "greeting.txt"),
+		filepath.Join(cmdDirPath, "main.go"),
+		filepath.Join(cmdDirPath, "static", "index.html"),
+	}, V(buildFilePaths(cmdDirPath)))
+
+	filePath := filepath.Join(prjDirPath, "hello.go")
+	V0(os.WriteFile(filePath, []byte("package main\n\nimport _ \"embed\"\n\n//go:embed \"greet/greeting.txt\"\nvar greeting string\n\nfunc main() {}\n"), 0644))
+	assert.Equal(t, []string{
+		filepath.Join(prjDirPath, "go.mod"),
+		filepath.Join(cmdDirPath, "greeting.txt"),
+		filePath,
+	}, V(buildFilePaths(filePath)))
+}
@@ -0,0 +1,93 @@
+package golang
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	buildDirectivePrefix = "//binc:build "
+	envDirectivePrefix   = "//binc:env "
+)
+
+// Environment variables of the process which affect the result of `go build`.
+var buildEnvNames = []string{
+	"CGO_ENABLED",
+	"CGO_CFLAGS",
+	"CGO_CPPFLAGS",
+	"CGO_CXXFLAGS",
+	"CGO_LDFLAGS",
+	"CC",
+	"CXX",
+	"GOARCH",
+	"GOOS",
+	"GOAMD64",
+	"GOARM",
+	"GOARM64",
+	"GOEXPERIMENT",
+	"GOFLAGS",
+}
+
+// buildDirectives holds the flags for `go build` and the environment variables given by `//binc:build` and `//binc:env` comments.
+type buildDirectives struct {
+	flags []string
+	env   []string
+}
+
+// readBuildDirectives reads the directives in the main file or in the files of the main package directory.
+func readBuildDirectives(goTargetPath string) (directives *buildDirectives, err error) {
+	defer Catch(&err)
+	directives = &buildDirectives{}
+	filePaths := []string{goTargetPath}
+	if stat := V(os.Stat(goTargetPath)); stat.IsDir() {
+		filePaths = V(goSourceFiles(goTargetPath))
+	}
+	for _, filePath := range filePaths {
+		(func() {
+			in := V(os.Open(filePath))
+			defer (func() { Ignore(in.Close()) })()
+			scanner := bufio.NewScanner(in)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if strings.HasPrefix(line, buildDirectivePrefix) {
+					directives.flags = append(directives.flags, V(common.SplitDirectiveArgs(line[len(buildDirectivePrefix):]))...)
+				} else if strings.HasPrefix(line, envDirectivePrefix) {
+					for _, envEntry := range V(common.SplitDirectiveArgs(line[len(envDirectivePrefix):])) {
+						if !strings.Contains(envEntry, "=") {
+							panic(errors.New(fmt.Sprintf("invalid environment variable in %s: %s", filePath, envEntry)))
+						}
+						directives.env = append(directives.env, envEntry)
+					}
+				}
+			}
+			V0(scanner.Err())
+		})()
+	}
+	return directives, nil
+}
+
+// buildEnv returns the environment variables which affect the build: the relevant ones of the process overridden by the directives.
+func buildEnv(directiveEnv []string) (env []string) {
+	envMap := map[string]string{}
+	for _, name := range buildEnvNames {
+		// The go command treats empty variables as unset.
+		if value := os.Getenv(name); value != "" {
+			envMap[name] = value
+		}
+	}
+	for _, envEntry := range directiveEnv {
+		name, value, _ := strings.Cut(envEntry, "=")
+		envMap[name] = value
+	}
+	for name, value := range envMap {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
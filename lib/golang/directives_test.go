@@ -0,0 +1,41 @@
+package golang
+
+import (
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The directives are passed to `go build` and separate cache entries are used for different flags.
+func TestBuildDirectives(t *testing.T) {
+	for _, name := range buildEnvNames {
+		t.Setenv(name, "")
+	}
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	dirPath := t.TempDir()
+	V0(os.WriteFile(filepath.Join(dirPath, "go.mod"), []byte("module example.com/foo\n\ngo 1.21\n"), 0644))
+	goFilePath := filepath.Join(dirPath, "hello.go")
+	V0(os.WriteFile(goFilePath, []byte(`package main
+
+//binc:build -ldflags "-X main.greeting=Hi"
+//binc:env CGO_ENABLED=0
+
+var greeting = "Hello"
+
+func main() { println(greeting) }
+`), 0644))
+	directives := V(readBuildDirectives(goFilePath))
+	assert.Equal(t, []string{"-ldflags", "-X main.greeting=Hi"}, directives.flags)
+	assert.Equal(t, []string{"CGO_ENABLED=0"}, directives.env)
+	buildInfo, _, err := exeBuildInfo(goFilePath)
+	V0(err)
+	assert.Equal(t, []string{"-tags", "", "-ldflags", "-X main.greeting=Hi"}, buildInfo.Args)
+	assert.Equal(t, []string{"CGO_ENABLED=0"}, buildInfo.Env)
+	t.Setenv("GOFLAGS", "-trimpath")
+	buildInfoWithEnv, _, err := exeBuildInfo(goFilePath)
+	V0(err)
+	assert.NotEqual(t, buildInfo.HashStr, buildInfoWithEnv.HashStr)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"github.com/knaka/binc/lib/common"
 	. "github.com/knaka/go-utils"
 	"os"
 	"os/exec"
@@ -46,6 +47,9 @@ var goCmd = sync.OnceValues(func() (goPath string, err error) {
 	if stat, err := os.Stat(path); err == nil && !stat.IsDir() {
 		return path, nil
 	}
+	if path := common.ToolPath("go"); path != "" {
+		return path, nil
+	}
 	goPath = V(exec.LookPath("go"))
 	if err == nil {
 		return goPath, nil
@@ -1,68 +1,93 @@
 package golang
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/knaka/binc/lib/common"
 	. "github.com/knaka/go-utils"
 	"github.com/samber/lo"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
 const goExt = ".go"
 
-func ensureExeFile(goTargetPath string, shouldRebuild bool) (exePath string, err error) {
+// exeBuildInfo returns the build information of the main file or the main package directory and the path of the cached executable for it.
+func exeBuildInfo(goTargetPath string) (buildInfo *common.BuildInfo, exePath string, err error) {
 	defer Catch(&err)
-	buildArgsWoTgt := []string{"-tags", ""}
-	var fileInfoList []*common.FileInfo
+	directives := V(readBuildDirectives(goTargetPath))
+	// The flags in the configuration come first so that the directives of the command take precedence.
+	buildArgsWoTgt := append([]string{"-tags", ""}, common.BuildFlags("go", filepath.Dir(goTargetPath))...)
+	buildArgsWoTgt = append(buildArgsWoTgt, directives.flags...)
 	var baseWithoutExt string
 	if stat := V(os.Stat(goTargetPath)); stat.IsDir() {
 		baseWithoutExt = filepath.Base(goTargetPath)
-		files := V(filepath.Glob(filepath.Join(goTargetPath, "*"+goExt)))
-		for _, file := range files {
-			fileInfoList = append(fileInfoList, V(common.GetFileInfo(file)))
-		}
 	} else {
 		goFileBase := filepath.Base(goTargetPath)
 		baseWithoutExt = goFileBase[:len(goFileBase)-len(filepath.Ext(goFileBase))]
-		fileInfoList = append(fileInfoList, V(common.GetFileInfo(goTargetPath)))
 	}
-	goModFilePath, err := findGoModFile(filepath.Dir(goTargetPath))
-	if err == nil {
-		fileInfoList = append(fileInfoList, V(common.GetFileInfo(goModFilePath)))
+	// Every local package the command depends on and the module files affect the build.
+	var fileInfoList []*common.FileInfo
+	for _, filePath := range V(buildFilePaths(goTargetPath)) {
+		fileInfoList = append(fileInfoList, V(common.GetFileInfo(filePath)))
 	}
-	buildInfo := common.NewBuildInfo(
+	buildInfo = common.NewBuildInfo(
 		V(goEnv()).Version,
 		buildArgsWoTgt,
 		fileInfoList,
+		common.WithEnv(buildEnv(directives.env)),
 	)
 	exePath = V(common.CachedExePath(buildInfo.Hash, baseWithoutExt))
+	return buildInfo, exePath, nil
+}
+
+func ensureExeFile(goTargetPath string, shouldRebuild bool) (exePath string, err error) {
+	_, exePath, err = ensureBuiltExe(goTargetPath, shouldRebuild)
+	return exePath, err
+}
+
+// ensureBuiltExe builds the executable into the cache if it is not there, and returns the build information as well as its path.
+func ensureBuiltExe(goTargetPath string, shouldRebuild bool) (buildInfo *common.BuildInfo, exePath string, err error) {
+	defer Catch(&err)
+	buildInfo, exePath, err = exeBuildInfo(goTargetPath)
+	if err != nil {
+		return nil, "", err
+	}
 	// If the cache binary is not found, build it.
-	if _, err := os.Stat(exePath); err != nil || shouldRebuild {
-		prevWd := V(os.Getwd())
-		V0(os.Chdir(filepath.Dir(goTargetPath)))
-		defer (func() { Ignore(os.Chdir(prevWd)) })()
+	V0(common.EnsureBuilt(buildInfo, exePath, shouldRebuild, func(tempPath string) error {
 		buildCommand := []string{"build"}
-		buildCommand = append(buildCommand, "-o", exePath)
+		buildCommand = append(buildCommand, "-o", tempPath)
 		// Due to an inconvenient behavior of filepath.Join(), which removes the trailing dot, this approach is used instead.
 		targetPath := fmt.Sprintf(".%c%s", filepath.Separator, filepath.Base(goTargetPath))
-		buildArgs := append(buildArgsWoTgt, targetPath)
+		buildArgs := append(slices.Clone(buildInfo.Args), targetPath)
 		buildCommand = append(buildCommand, buildArgs...)
 		cmd := exec.Command(V(goCmd()), buildCommand...)
+		cmd.Dir = filepath.Dir(goTargetPath)
+		cmd.Env = append(os.Environ(), buildInfo.Env...)
 		cmd.Stdout = os.Stderr
 		cmd.Stderr = os.Stderr
-		V0(cmd.Run())
-		V0(os.Chdir(prevWd))
-		buildInfoJson := V(json.Marshal(buildInfo))
-		V0(os.WriteFile(V(common.InfoFilePath(buildInfo.Hash)), buildInfoJson, 0644))
-		log.Println("built:", exePath)
+		return cmd.Run()
+	}))
+	return buildInfo, exePath, nil
+}
+
+// launchStamp builds the executable if necessary and returns the stamp to launch it.
+func launchStamp(goTargetPath string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
+	defer Catch(&err)
+	buildInfo, exePath, err := ensureBuiltExe(goTargetPath, shouldRebuild)
+	if err != nil {
+		return nil, err
 	}
-	return exePath, nil
+	return common.NewLaunchStamp(
+		[]string{exePath},
+		exePath,
+		buildInfo,
+		append([]string{"GOROOT"}, buildEnvNames...),
+		V(goCmd()),
+	), nil
 }
 
 // --------
@@ -72,6 +97,9 @@ type GoMainFileManager struct {
 }
 
 var _ common.Manager = &GoMainFileManager{}
+var _ common.CacheChecker = &GoMainFileManager{}
+var _ common.Builder = &GoMainFileManager{}
+var _ common.FastLauncher = &GoMainFileManager{}
 
 func (m *GoMainFileManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
 	for _, goFilePath := range m.goFilePaths {
@@ -97,11 +125,43 @@ func (m *GoMainFileManager) Run(args []string, shouldRebuild bool) (err error) {
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		return cmd.Run()
+		return common.RunCommand(cmd)
 	}
 	return errors.New(fmt.Sprintf("no matching go file found: %s", args[0]))
 }
 
+func (m *GoMainFileManager) Build(cmdBase string, shouldRebuild bool) (err error) {
+	for _, goFilePath := range m.goFilePaths {
+		if filepath.Base(goFilePath) != cmdBase+goExt {
+			continue
+		}
+		_, err = ensureExeFile(goFilePath, shouldRebuild)
+		return
+	}
+	return errors.New(fmt.Sprintf("no matching go file found: %s", cmdBase))
+}
+
+func (m *GoMainFileManager) LaunchStamp(cmdBase string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
+	for _, goFilePath := range m.goFilePaths {
+		if filepath.Base(goFilePath) != cmdBase+goExt {
+			continue
+		}
+		return launchStamp(goFilePath, shouldRebuild)
+	}
+	return nil, errors.New(fmt.Sprintf("no matching go file found: %s", cmdBase))
+}
+
+func (m *GoMainFileManager) CachedPath(cmdBase string) (cachedPath string, err error) {
+	for _, goFilePath := range m.goFilePaths {
+		if filepath.Base(goFilePath) != cmdBase+goExt {
+			continue
+		}
+		_, cachedPath, err = exeBuildInfo(goFilePath)
+		return
+	}
+	return "", errors.New(fmt.Sprintf("no matching go file found: %s", cmdBase))
+}
+
 // CanRun checks if the command can be run by this manager.
 func (m *GoMainFileManager) CanRun(cmdBase string) bool {
 	for _, goFilePath := range m.goFilePaths {
@@ -136,6 +196,9 @@ type GoMainPackageManager struct {
 }
 
 var _ common.Manager = &GoMainPackageManager{}
+var _ common.CacheChecker = &GoMainPackageManager{}
+var _ common.Builder = &GoMainPackageManager{}
+var _ common.FastLauncher = &GoMainPackageManager{}
 
 func (m *GoMainPackageManager) CanRun(cmdBase string) bool {
 	for _, mainDirPath := range m.mainDirPaths {
@@ -159,11 +222,43 @@ func (m *GoMainPackageManager) Run(args []string, shouldRebuild bool) (err error
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		return cmd.Run()
+		return common.RunCommand(cmd)
 	}
 	return errors.New(fmt.Sprintf("no matching go main directory found: %s", args[0]))
 }
 
+func (m *GoMainPackageManager) Build(cmdBase string, shouldRebuild bool) (err error) {
+	for _, mainDirPath := range m.mainDirPaths {
+		if filepath.Base(mainDirPath) != cmdBase {
+			continue
+		}
+		_, err = ensureExeFile(mainDirPath, shouldRebuild)
+		return
+	}
+	return errors.New(fmt.Sprintf("no matching go main directory found: %s", cmdBase))
+}
+
+func (m *GoMainPackageManager) LaunchStamp(cmdBase string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
+	for _, mainDirPath := range m.mainDirPaths {
+		if filepath.Base(mainDirPath) != cmdBase {
+			continue
+		}
+		return launchStamp(mainDirPath, shouldRebuild)
+	}
+	return nil, errors.New(fmt.Sprintf("no matching go main directory found: %s", cmdBase))
+}
+
+func (m *GoMainPackageManager) CachedPath(cmdBase string) (cachedPath string, err error) {
+	for _, mainDirPath := range m.mainDirPaths {
+		if filepath.Base(mainDirPath) != cmdBase {
+			continue
+		}
+		_, cachedPath, err = exeBuildInfo(mainDirPath)
+		return
+	}
+	return "", errors.New(fmt.Sprintf("no matching go main directory found: %s", cmdBase))
+}
+
 func (m *GoMainPackageManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
 	for _, mainDirPath := range m.mainDirPaths {
 		infoList = append(infoList, &common.CommandBaseInfo{
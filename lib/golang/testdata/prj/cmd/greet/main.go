@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/knaka/prj/internal/greeting"
+)
+
+func main() {
+	fmt.Println(greeting.Greet())
+}
@@ -0,0 +1,7 @@
+package greeting
+
+import "github.com/knaka/prj/internal/names"
+
+func Greet() string {
+	return "Hello, " + names.World() + "!"
+}
@@ -0,0 +1,5 @@
+package names
+
+func World() string {
+	return "World"
+}
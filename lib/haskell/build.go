@@ -0,0 +1,534 @@
+package haskell
+
+import (
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Files next to “cabal.project” which affect the build.
+var projectFileBases = []string{
+	"cabal.project",
+	"cabal.project.local",
+	"cabal.project.freeze",
+}
+
+// Files next to “stack.yaml” which affect the build.
+var stackFileBases = []string{
+	"stack.yaml",
+	"stack.yaml.lock",
+}
+
+// Build directories of the tools, whose sources are not of the package.
+var buildDirBases = []string{
+	"dist-newstyle",
+	".stack-work",
+}
+
+// reStackScriptHeader matches the header of a stack script such as “{- stack script --resolver lts-22.33 --package text -}”.
+var reStackScriptHeader = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?s)\{-\s*stack\s+(.*?)-\}`)
+})
+
+// reImport matches the module of an import declaration such as “import qualified Data.Map as M”.
+var reImport = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^import\s+(?:safe\s+)?(?:qualified\s+)?(?:"[^"]*"\s+)?([A-Z][\w.]*)`)
+})
+
+func containsCabalScriptBlockStartMarker(hsFilePath string) bool {
+	in, err := os.Open(hsFilePath)
+	if err != nil {
+		return false
+	}
+	defer (func() { Ignore(in.Close()) })()
+	buf := make([]byte, 1024)
+	n, _ := in.Read(buf)
+	return strings.Contains(string(buf[:n]), "{- cabal:")
+}
+
+// readStackScriptArgs returns the arguments of stack in the header of the script, or nil if it is not a stack script.
+func readStackScriptArgs(hsFilePath string) (args []string, err error) {
+	defer Catch(&err)
+	in := V(os.Open(hsFilePath))
+	defer (func() { Ignore(in.Close()) })()
+	buf := make([]byte, 4096)
+	n, _ := in.Read(buf)
+	match := reStackScriptHeader().FindStringSubmatch(string(buf[:n]))
+	if match == nil {
+		return nil, nil
+	}
+	return common.SplitDirectiveArgs(strings.Join(strings.Fields(match[1]), " "))
+}
+
+// stackGhcArgs returns the arguments of “stack ghc” from the ones in the header of a stack script: the snapshot and the packages.
+func stackGhcArgs(scriptArgs []string) (globalArgs []string, ghcArgs []string) {
+	for i := 0; i < len(scriptArgs); i++ {
+		name, value, hasValue := strings.Cut(scriptArgs[i], "=")
+		if !hasValue && i+1 < len(scriptArgs) {
+			value = scriptArgs[i+1]
+		}
+		switch name {
+		case "--resolver", "--snapshot":
+			globalArgs = append(globalArgs, "--resolver", value)
+		case "--package":
+			ghcArgs = append(ghcArgs, "--package", value)
+		default:
+			continue
+		}
+		if !hasValue {
+			i++
+		}
+	}
+	return globalArgs, ghcArgs
+}
+
+// findUpward returns the nearest file with one of the names in the directory of the sources or above it.
+func findUpward(exeLikePath string, patterns ...string) (filePath string, err error) {
+	defer Catch(&err)
+	dirPathPrev := ""
+	dirPath := exeLikePath
+	if !V(os.Stat(exeLikePath)).IsDir() {
+		dirPath = filepath.Dir(exeLikePath)
+	}
+	for dirPath != dirPathPrev {
+		for _, pattern := range patterns {
+			if filePaths := V(filepath.Glob(filepath.Join(dirPath, pattern))); len(filePaths) > 0 {
+				return filePaths[0], nil
+			}
+		}
+		dirPathPrev = dirPath
+		dirPath = filepath.Dir(dirPath)
+	}
+	return "", errors.New(fmt.Sprintf("no %s found", strings.Join(patterns, " or ")))
+}
+
+// findPackageFileIn returns the package description in the directory.
+func findPackageFileIn(dirPath string) (packageFilePath string, err error) {
+	defer Catch(&err)
+	for _, pattern := range []string{"*.cabal", "package.yaml"} {
+		if filePaths := V(filepath.Glob(filepath.Join(dirPath, pattern))); len(filePaths) > 0 {
+			return filePaths[0], nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("no package description found: %s", dirPath))
+}
+
+// findPackageFile returns the nearest package description, “*.cabal” or “package.yaml” of hpack, in the directory of the sources or above it.
+func findPackageFile(exeLikePath string) (packageFilePath string, err error) {
+	return findUpward(exeLikePath, "*.cabal", "package.yaml")
+}
+
+// localModules returns the source file and the local modules it imports transitively, which ghc finds next to it.
+func localModules(hsFilePath string) (filePaths []string, err error) {
+	defer Catch(&err)
+	rootDirPath := filepath.Dir(hsFilePath)
+	visited := map[string]bool{}
+	queue := []string{hsFilePath}
+	for len(queue) > 0 {
+		filePath := queue[0]
+		queue = queue[1:]
+		if visited[filePath] {
+			continue
+		}
+		visited[filePath] = true
+		filePaths = append(filePaths, filePath)
+		for _, match := range reImport().FindAllStringSubmatch(string(V(os.ReadFile(filePath))), -1) {
+			modulePath := filepath.Join(append([]string{rootDirPath}, strings.Split(match[1], ".")...)...)
+			for _, ext := range []string{".hs", ".lhs"} {
+				if _, err := os.Stat(modulePath + ext); err == nil {
+					queue = append(queue, modulePath+ext)
+				}
+			}
+		}
+	}
+	return filePaths, nil
+}
+
+// findProjectFiles returns the files of the nearest project at or above the directory, such as “cabal.project”.
+func findProjectFiles(dirPath string) (filePaths []string) {
+	dirPathPrev := ""
+	for ; dirPath != dirPathPrev; dirPath = filepath.Dir(dirPath) {
+		for _, base := range projectFileBases {
+			if _, err := os.Stat(filepath.Join(dirPath, base)); err == nil {
+				filePaths = append(filePaths, filepath.Join(dirPath, base))
+			}
+		}
+		if len(filePaths) > 0 {
+			return filePaths
+		}
+		dirPathPrev = dirPath
+	}
+	return nil
+}
+
+// packageFilePaths returns the files which affect the build of the package: its sources and its description.
+func packageFilePaths(packageFilePath string) (filePaths []string, err error) {
+	defer Catch(&err)
+	packageDirPath := filepath.Dir(packageFilePath)
+	V0(filepath.WalkDir(packageDirPath, func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirEntry.IsDir() {
+			if path != packageDirPath && (slices.Contains(buildDirBases, dirEntry.Name()) || strings.HasPrefix(dirEntry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			// Another package nested in the directory, as in a project of stack.
+			if path != packageDirPath && E(findPackageFileIn(path)) == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".hs") || strings.HasSuffix(path, ".lhs") {
+			filePaths = append(filePaths, path)
+		}
+		return nil
+	}))
+	// Both of the descriptions affect the build if hpack generates the one of cabal.
+	for _, pattern := range []string{"*.cabal", "package.yaml"} {
+		filePaths = append(filePaths, V(filepath.Glob(filepath.Join(packageDirPath, pattern)))...)
+	}
+	return filePaths, nil
+}
+
+// readProjectPackages returns the values of the “packages” and “optional-packages” fields of “cabal.project”,
+// which are written after the field names and on the following indented lines, separated by spaces or commas.
+func readProjectPackages(projectFilePath string) (patterns []string, err error) {
+	defer Catch(&err)
+	inField := false
+	for _, line := range strings.Split(string(V(os.ReadFile(projectFilePath))), "\n") {
+		line, _, _ = strings.Cut(line, "--")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			name, value, found := strings.Cut(line, ":")
+			name = strings.ToLower(strings.TrimSpace(name))
+			inField = found && (name == "packages" || name == "optional-packages")
+			if !inField {
+				continue
+			}
+			line = value
+		}
+		if inField {
+			patterns = append(patterns, strings.FieldsFunc(line, func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t'
+			})...)
+		}
+	}
+	return patterns, nil
+}
+
+// readStackPackages returns the directories of the local packages listed in “packages” of “stack.yaml”, which is “.” by default.
+func readStackPackages(stackFilePath string) (dirPaths []string, err error) {
+	defer Catch(&err)
+	inField := false
+	for _, line := range strings.Split(string(V(os.ReadFile(stackFilePath))), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if inField && strings.HasPrefix(trimmed, "- ") {
+			dirPaths = append(dirPaths, strings.Trim(strings.TrimSpace(trimmed[2:]), `"'`))
+			continue
+		}
+		inField = false
+		name, value, found := strings.Cut(line, ":")
+		if !found || name != "packages" {
+			continue
+		}
+		if value = strings.TrimSpace(value); value == "" {
+			inField = true
+			continue
+		}
+		// The flow style such as “[., lib]”.
+		for _, dirPath := range strings.Split(strings.Trim(value, "[]"), ",") {
+			if dirPath = strings.Trim(strings.TrimSpace(dirPath), `"'`); dirPath != "" {
+				dirPaths = append(dirPaths, dirPath)
+			}
+		}
+	}
+	if dirPaths == nil {
+		return []string{"."}, nil
+	}
+	return dirPaths, nil
+}
+
+// localPackageFiles returns the descriptions of the local packages which the patterns relative to the directory of the project point to:
+// the descriptions themselves or the directories of the packages. Remote packages are ignored.
+func localPackageFiles(projectDirPath string, patterns []string) (packageFilePaths []string, err error) {
+	defer Catch(&err)
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "://") || strings.HasSuffix(pattern, ".tar.gz") {
+			continue
+		}
+		for _, path := range V(filepath.Glob(filepath.Join(projectDirPath, pattern))) {
+			if !V(os.Stat(path)).IsDir() {
+				packageFilePaths = append(packageFilePaths, path)
+				continue
+			}
+			if packageFilePath, err := findPackageFileIn(path); err == nil {
+				packageFilePaths = append(packageFilePaths, packageFilePath)
+			}
+		}
+	}
+	return packageFilePaths, nil
+}
+
+// projectPackageFilePaths returns the files of the local packages of the project other than the package itself,
+// as a change in a library which the executable depends on affects its build.
+func projectPackageFilePaths(packageFilePath string, packageFilesOfProject []string) (filePaths []string, err error) {
+	defer Catch(&err)
+	visited := map[string]bool{filepath.Dir(packageFilePath): true}
+	for _, otherPackageFilePath := range packageFilesOfProject {
+		if visited[filepath.Dir(otherPackageFilePath)] {
+			continue
+		}
+		visited[filepath.Dir(otherPackageFilePath)] = true
+		filePaths = append(filePaths, V(packageFilePaths(otherPackageFilePath))...)
+	}
+	return filePaths, nil
+}
+
+// haskellTargetT is how a command is built: with cabal as an executable of a package or as a script with a cabal header,
+// with stack as an executable of a package in a project or as a script with a stack header, or with ghc as a standalone source.
+type haskellTargetT struct {
+	cmdBase string
+	// exeLikePath is the source or the directory of the sources which the command is found as.
+	exeLikePath string
+	// tool is the build tool: “cabal”, “stack” or “ghc”.
+	tool string
+	// packageFilePath is the package description, or an empty string for a script or a standalone source.
+	packageFilePath string
+	// stackFilePath is the “stack.yaml” of the project built with stack.
+	stackFilePath string
+	// stackScriptArgs are the arguments of stack in the header of a stack script.
+	stackScriptArgs []string
+}
+
+// buildDirPath returns the directory where the build tool is run.
+func (t *haskellTargetT) buildDirPath() string {
+	if t.stackFilePath != "" {
+		return filepath.Dir(t.stackFilePath)
+	}
+	if t.packageFilePath != "" {
+		return filepath.Dir(t.packageFilePath)
+	}
+	if stat, err := os.Stat(t.exeLikePath); err == nil && stat.IsDir() {
+		return t.exeLikePath
+	}
+	return filepath.Dir(t.exeLikePath)
+}
+
+// cabalTarget returns the target of the cabal commands: the executable of the package, or the script itself.
+func (t *haskellTargetT) cabalTarget() string {
+	if t.packageFilePath != "" {
+		return "exe:" + t.cmdBase
+	}
+	return t.exeLikePath
+}
+
+// mainFilePath returns the source with the main function for ghc: the file itself, or “Main.hs” in the directory.
+func (t *haskellTargetT) mainFilePath() string {
+	if stat, err := os.Stat(t.exeLikePath); err == nil && stat.IsDir() {
+		return filepath.Join(t.exeLikePath, "Main.hs")
+	}
+	return t.exeLikePath
+}
+
+// buildFilePaths returns the files which affect the build of the command.
+func (t *haskellTargetT) buildFilePaths() (filePaths []string, err error) {
+	defer Catch(&err)
+	switch {
+	case t.packageFilePath != "":
+		filePaths = V(packageFilePaths(t.packageFilePath))
+	case t.tool == "ghc":
+		filePaths = V(localModules(t.mainFilePath()))
+	default:
+		filePaths = []string{t.exeLikePath}
+	}
+	if t.tool == "stack" && t.stackFilePath != "" {
+		if t.packageFilePath != "" {
+			dirPaths := V(readStackPackages(t.stackFilePath))
+			packageFilesOfProject := V(localPackageFiles(filepath.Dir(t.stackFilePath), dirPaths))
+			filePaths = append(filePaths, V(projectPackageFilePaths(t.packageFilePath, packageFilesOfProject))...)
+		}
+		for _, base := range stackFileBases {
+			if filePath := filepath.Join(filepath.Dir(t.stackFilePath), base); E(os.Stat(filePath)) == nil {
+				filePaths = append(filePaths, filePath)
+			}
+		}
+	}
+	if t.tool == "cabal" {
+		projectFilePaths := findProjectFiles(t.buildDirPath())
+		if t.packageFilePath != "" && len(projectFilePaths) > 0 && filepath.Base(projectFilePaths[0]) == "cabal.project" {
+			patterns := V(readProjectPackages(projectFilePaths[0]))
+			packageFilesOfProject := V(localPackageFiles(filepath.Dir(projectFilePaths[0]), patterns))
+			filePaths = append(filePaths, V(projectPackageFilePaths(t.packageFilePath, packageFilesOfProject))...)
+		}
+		filePaths = append(filePaths, projectFilePaths...)
+	}
+	return filePaths, nil
+}
+
+// exeBuildInfo returns the build information of the command, keyed on the files of the package or the script including its header
+// and on the version of the tools, and the path of the cached executable.
+func exeBuildInfo(target *haskellTargetT) (buildInfo *common.BuildInfo, exePath string, err error) {
+	defer Catch(&err)
+	var fileInfoList []*common.FileInfo
+	for _, filePath := range V(target.buildFilePaths()) {
+		fileInfoList = append(fileInfoList, V(common.GetFileInfo(filePath)))
+	}
+	// The version of GHC is decided by the snapshot in the files for stack.
+	versionFn := ghcVersion
+	if target.tool == "stack" {
+		versionFn = stackVersion
+	}
+	version := V(versionFn())
+	buildInfo = common.NewBuildInfo(
+		version,
+		append([]string{target.tool, target.cabalTarget()}, common.BuildFlags("haskell", filepath.Dir(target.exeLikePath))...),
+		fileInfoList,
+	)
+	exePath = V(common.CachedExePath(buildInfo.Hash, target.cmdBase))
+	return buildInfo, exePath, nil
+}
+
+// copyExecutable copies the executable built by cabal into the cache.
+func copyExecutable(srcPath string, dstPath string) (err error) {
+	defer Catch(&err)
+	in := V(os.Open(srcPath))
+	defer (func() { Ignore(in.Close()) })()
+	out := V(os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755))
+	defer (func() { Ignore(out.Close()) })()
+	V0(out.ReadFrom(in))
+	return out.Close()
+}
+
+// cabalBuild builds the target with cabal and returns the path of the executable in its build directory.
+func cabalBuild(target *haskellTargetT, flags []string) (builtExePath string, err error) {
+	defer Catch(&err)
+	cmd := exec.Command(V(cabalCmd()), append([]string{"build", target.cabalTarget()}, flags...)...)
+	cmd.Dir = target.buildDirPath()
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	V0(cmd.Run())
+	cmd = exec.Command(V(cabalCmd()), append([]string{"list-bin", "-v0", target.cabalTarget()}, flags...)...)
+	cmd.Dir = target.buildDirPath()
+	cmd.Stderr = os.Stderr
+	builtExePath = strings.TrimSpace(string(V(cmd.Output())))
+	if builtExePath == "" {
+		return "", errors.New(fmt.Sprintf("no executable built: %s", target.cabalTarget()))
+	}
+	return builtExePath, nil
+}
+
+// stackBuild builds the package with stack and returns the path of the executable copied into the directory.
+func stackBuild(target *haskellTargetT, flags []string, binDirPath string) (builtExePath string, err error) {
+	defer Catch(&err)
+	args := append([]string{"build", filepath.Dir(target.packageFilePath), "--copy-bins", "--local-bin-path", binDirPath}, flags...)
+	cmd := exec.Command(V(stackCmd()), args...)
+	cmd.Dir = target.buildDirPath()
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	V0(cmd.Run())
+	return filepath.Join(binDirPath, target.cmdBase+Ternary(runtime.GOOS == "windows", ".exe", "")), nil
+}
+
+// ghcCompile compiles the standalone source, or the script with the snapshot and the packages in its stack header, into the path.
+func ghcCompile(target *haskellTargetT, flags []string, outputDirPath string, exePath string) (err error) {
+	defer Catch(&err)
+	ghcArgs := []string{"-O"}
+	if target.tool == "ghc" {
+		ghcArgs = append(ghcArgs, "-i"+filepath.Dir(target.mainFilePath()))
+	}
+	ghcArgs = append(ghcArgs, flags...)
+	ghcArgs = append(ghcArgs, "-outputdir", outputDirPath, "-o", exePath, target.mainFilePath())
+	var cmd *exec.Cmd
+	if target.tool == "stack" {
+		globalArgs, packageArgs := stackGhcArgs(target.stackScriptArgs)
+		args := append(globalArgs, "ghc")
+		args = append(args, packageArgs...)
+		cmd = exec.Command(V(stackCmd()), append(append(args, "--"), ghcArgs...)...)
+	} else {
+		cmd = exec.Command(V(ghcCmd()), ghcArgs...)
+	}
+	cmd.Dir = target.buildDirPath()
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func ensureExeFile(target *haskellTargetT, shouldRebuild bool) (buildInfo *common.BuildInfo, exePath string, err error) {
+	defer Catch(&err)
+	buildInfo, exePath, err = exeBuildInfo(target)
+	if err != nil {
+		return nil, "", err
+	}
+	V0(common.EnsureBuilt(buildInfo, exePath, shouldRebuild, func(tempPath string) (err error) {
+		defer Catch(&err)
+		// The first arguments are the tool and the target of cabal.
+		flags := slices.Clone(buildInfo.Args[2:])
+		switch {
+		case target.tool == "cabal":
+			return copyExecutable(V(cabalBuild(target, flags)), tempPath)
+		case target.tool == "stack" && target.packageFilePath != "":
+			binDirPath := V(os.MkdirTemp("", "binc-stack"))
+			defer (func() { Ignore(os.RemoveAll(binDirPath)) })()
+			return copyExecutable(V(stackBuild(target, flags, binDirPath)), tempPath)
+		default:
+			// Keep the object files out of the directory of the sources.
+			outputDirPath := V(os.MkdirTemp("", "binc-ghc"))
+			defer (func() { Ignore(os.RemoveAll(outputDirPath)) })()
+			return ghcCompile(target, flags, outputDirPath, tempPath)
+		}
+	}))
+	return buildInfo, exePath, nil
+}
+
+var cabalCmd = sync.OnceValues(func() (cabalPath string, err error) {
+	defer Catch(&err)
+	if path := common.ToolPath("cabal"); path != "" {
+		return path, nil
+	}
+	return V(exec.LookPath("cabal")), nil
+})
+
+var ghcCmd = sync.OnceValues(func() (ghcPath string, err error) {
+	defer Catch(&err)
+	if path := common.ToolPath("ghc"); path != "" {
+		return path, nil
+	}
+	return V(exec.LookPath("ghc")), nil
+})
+
+var stackCmd = sync.OnceValues(func() (stackPath string, err error) {
+	defer Catch(&err)
+	if path := common.ToolPath("stack"); path != "" {
+		return path, nil
+	}
+	return V(exec.LookPath("stack")), nil
+})
+
+// stackVersion returns the version of stack such as “stack 3.1.1”.
+var stackVersion = sync.OnceValues(func() (version string, err error) {
+	defer Catch(&err)
+	return "stack " + strings.TrimSpace(string(V(exec.Command(V(stackCmd()), "--numeric-version").Output()))), nil
+})
+
+// ghcVersion returns the version of GHC such as “ghc 9.6.6”, which cabal builds with by default.
+var ghcVersion = sync.OnceValues(func() (version string, err error) {
+	defer Catch(&err)
+	return "ghc " + strings.TrimSpace(string(V(exec.Command(V(ghcCmd()), "--numeric-version").Output()))), nil
+})
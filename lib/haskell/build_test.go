@@ -0,0 +1,128 @@
+package haskell
+
+import (
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setFakeTools puts the build tools which do nothing on $PATH for the test, and makes the lookups find them.
+func setFakeTools(t *testing.T) {
+	cabalPath := common.InstallFakeTool(t, "cabal", "#!/bin/sh\n")
+	stackPath := common.InstallFakeTool(t, "stack", "#!/bin/sh\n")
+	ghcPath := common.InstallFakeTool(t, "ghc", "#!/bin/sh\n")
+	cabalCmdOrig, stackCmdOrig, ghcCmdOrig := cabalCmd, stackCmd, ghcCmd
+	t.Cleanup(func() { cabalCmd, stackCmd, ghcCmd = cabalCmdOrig, stackCmdOrig, ghcCmdOrig })
+	cabalCmd = func() (string, error) { return cabalPath, nil }
+	stackCmd = func() (string, error) { return stackPath, nil }
+	ghcCmd = func() (string, error) { return ghcPath, nil }
+}
+
+// The sources and the descriptions of the local packages and the project files are the files of a package command, and a script stands alone.
+func TestFindTarget(t *testing.T) {
+	setFakeTools(t)
+	dirPath := t.TempDir()
+	V0(os.WriteFile(filepath.Join(dirPath, "cabal.project"), []byte("packages: */*.cabal\n"), 0644))
+	packageDirPath := filepath.Join(dirPath, "greet")
+	V0(os.MkdirAll(filepath.Join(packageDirPath, "dist-newstyle"), 0755))
+	V0(os.WriteFile(filepath.Join(packageDirPath, "greet.cabal"), []byte("cabal-version: 3.0\nname: greet\n"), 0644))
+	V0(os.WriteFile(filepath.Join(packageDirPath, "Main.hs"), []byte("main = putStrLn \"Hi\"\n"), 0644))
+	V0(os.WriteFile(filepath.Join(packageDirPath, "dist-newstyle", "Ignored.hs"), nil, 0644))
+	// A local library which the executable depends on.
+	libDirPath := filepath.Join(dirPath, "util")
+	V0(os.MkdirAll(libDirPath, 0755))
+	V0(os.WriteFile(filepath.Join(libDirPath, "util.cabal"), []byte("cabal-version: 3.0\nname: util\n"), 0644))
+	V0(os.WriteFile(filepath.Join(libDirPath, "Util.hs"), []byte("module Util where\n"), 0644))
+	scriptPath := filepath.Join(dirPath, "SayHello.hs")
+	V0(os.WriteFile(scriptPath, []byte("{- cabal:\nbuild-depends: base\n-}\nmain = putStrLn \"Hello\"\n"), 0644))
+	manager := &CabalScriptManager{exeLikePaths: []string{packageDirPath, scriptPath}}
+
+	target := V(manager.findTarget("greet"))
+	assert.Equal(t, "cabal", target.tool)
+	assert.Equal(t, filepath.Join(packageDirPath, "greet.cabal"), target.packageFilePath)
+	assert.Equal(t, "exe:greet", target.cabalTarget())
+	assert.Equal(t, []string{
+		filepath.Join(packageDirPath, "Main.hs"),
+		filepath.Join(packageDirPath, "greet.cabal"),
+		filepath.Join(libDirPath, "Util.hs"),
+		filepath.Join(libDirPath, "util.cabal"),
+		filepath.Join(dirPath, "cabal.project"),
+	}, V(target.buildFilePaths()))
+
+	target = V(manager.findTarget("say-hello"))
+	assert.Equal(t, "cabal", target.tool)
+	assert.Empty(t, target.packageFilePath)
+	assert.Equal(t, scriptPath, target.cabalTarget())
+}
+
+// A package in a project with “stack.yaml” and a script with a stack header are built with stack, and a standalone source with ghc.
+func TestFindTargetStackAndGhc(t *testing.T) {
+	setFakeTools(t)
+	dirPath := t.TempDir()
+	projectDirPath := filepath.Join(dirPath, "greet")
+	V0(os.MkdirAll(filepath.Join(projectDirPath, "app"), 0755))
+	V0(os.WriteFile(filepath.Join(projectDirPath, "stack.yaml"), []byte("snapshot: lts-22.33\npackages:\n- .\n- lib # The library\n"), 0644))
+	V0(os.MkdirAll(filepath.Join(projectDirPath, "lib"), 0755))
+	V0(os.WriteFile(filepath.Join(projectDirPath, "lib", "package.yaml"), []byte("name: greet-lib\n"), 0644))
+	V0(os.WriteFile(filepath.Join(projectDirPath, "lib", "Lib.hs"), []byte("module Lib where\n"), 0644))
+	V0(os.WriteFile(filepath.Join(projectDirPath, "package.yaml"), []byte("name: greet\n"), 0644))
+	V0(os.WriteFile(filepath.Join(projectDirPath, "Main.hs"), []byte("main = putStrLn \"Hi\"\n"), 0644))
+	stackScriptPath := filepath.Join(dirPath, "Count.hs")
+	V0(os.WriteFile(stackScriptPath, []byte(`#!/usr/bin/env stack
+{- stack script
+   --resolver lts-22.33
+   --package text
+-}
+main = pure ()
+`), 0644))
+	ghcFilePath := filepath.Join(dirPath, "Hello.hs")
+	V0(os.WriteFile(ghcFilePath, []byte("import qualified Util.Text as T\nimport Data.List\nmain = T.hello\n"), 0644))
+	V0(os.MkdirAll(filepath.Join(dirPath, "Util"), 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, "Util", "Text.hs"), []byte("module Util.Text where\nhello = putStrLn \"Hello\"\n"), 0644))
+	manager := &CabalScriptManager{exeLikePaths: []string{projectDirPath, stackScriptPath, ghcFilePath}}
+
+	target := V(manager.findTarget("greet"))
+	assert.Equal(t, "stack", target.tool)
+	assert.Equal(t, filepath.Join(projectDirPath, "stack.yaml"), target.stackFilePath)
+	assert.Equal(t, []string{
+		filepath.Join(projectDirPath, "Main.hs"),
+		filepath.Join(projectDirPath, "package.yaml"),
+		filepath.Join(projectDirPath, "lib", "Lib.hs"),
+		filepath.Join(projectDirPath, "lib", "package.yaml"),
+		filepath.Join(projectDirPath, "stack.yaml"),
+	}, V(target.buildFilePaths()))
+
+	target = V(manager.findTarget("count"))
+	assert.Equal(t, "stack", target.tool)
+	globalArgs, ghcArgs := stackGhcArgs(target.stackScriptArgs)
+	assert.Equal(t, []string{"--resolver", "lts-22.33"}, globalArgs)
+	assert.Equal(t, []string{"--package", "text"}, ghcArgs)
+
+	target = V(manager.findTarget("hello"))
+	assert.Equal(t, "ghc", target.tool)
+	assert.Equal(t, []string{ghcFilePath, filepath.Join(dirPath, "Util", "Text.hs")}, V(target.buildFilePaths()))
+}
+
+// The fields of the packages span the following indented lines.
+func TestReadProjectPackages(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "cabal.project")
+	V0(os.WriteFile(filePath, []byte(`-- The packages
+packages: app/
+          lib/*.cabal, ./vendor/foo
+optional-packages: extra/*/
+with-compiler: ghc-9.6
+`), 0644))
+	assert.Equal(t, []string{"app/", "lib/*.cabal", "./vendor/foo", "extra/*/"}, V(readProjectPackages(filePath)))
+}
+
+// The packages of stack are listed in the block style or in the flow style, and default to the project directory.
+func TestReadStackPackages(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "stack.yaml")
+	V0(os.WriteFile(filePath, []byte("packages: [., \"lib\"]\n"), 0644))
+	assert.Equal(t, []string{".", "lib"}, V(readStackPackages(filePath)))
+	V0(os.WriteFile(filePath, []byte("snapshot: lts-22.33\n"), 0644))
+	assert.Equal(t, []string{"."}, V(readStackPackages(filePath)))
+}
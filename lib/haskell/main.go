@@ -1,7 +1,6 @@
 package haskell
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"github.com/knaka/binc/lib/common"
@@ -11,7 +10,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"sync"
 )
 
 type CabalScriptManager struct {
@@ -19,6 +17,9 @@ type CabalScriptManager struct {
 }
 
 var _ common.Manager = &CabalScriptManager{}
+var _ common.CacheChecker = &CabalScriptManager{}
+var _ common.Builder = &CabalScriptManager{}
+var _ common.FastLauncher = &CabalScriptManager{}
 
 // Sort in descending order of length.
 var extensions = []string{
@@ -57,6 +58,12 @@ outer:
 }
 
 func (m *CabalScriptManager) CanRun(cmdBase string) bool {
+	_, err := m.findExeLike(cmdBase)
+	return err == nil
+}
+
+// findExeLike returns the directory of the sources or the source which the command is found as.
+func (m *CabalScriptManager) findExeLike(cmdBase string) (exeLikePath string, err error) {
 	for _, exeLikePath := range m.exeLikePaths {
 		exeLikeBase := filepath.Base(exeLikePath)
 		stat, err := os.Stat(exeLikePath)
@@ -64,132 +71,98 @@ func (m *CabalScriptManager) CanRun(cmdBase string) bool {
 			continue
 		}
 		if stat.IsDir() {
-			if filepath.Base(exeLikePath) == cmdBase {
-				return true
+			if exeLikeBase == cmdBase {
+				return exeLikePath, nil
 			}
 		} else {
 			for _, ext := range extensions {
-				if strings.HasSuffix(exeLikeBase, ext) {
-					if exeLikeBase == cmdBase+ext ||
-						common.Camel2Kebab(exeLikeBase[:len(exeLikeBase)-len(ext)]) == cmdBase {
-						return true
-					}
+				if exeLikeBase == cmdBase+ext ||
+					exeLikeBase == common.Kebab2Camel(cmdBase)+ext {
+					return exeLikePath, nil
 				}
 			}
 		}
 	}
-	return false
+	return "", errors.New(fmt.Sprintf("no matching hs file found: %s", cmdBase))
 }
 
-func containsCabalScriptBlockStartMarker(hsFilePath string) bool {
-	in := V(os.Open(hsFilePath))
-	defer func() { V0(in.Close()) }()
-	buf := make([]byte, 1024)
-	n := V(in.Read(buf))
-	return strings.Contains(string(buf[:n]), "{- cabal:")
-}
-
-func findCabalFile(exeLikePath string) (cabalFile string, err error) {
+// findTarget returns how the command is built: as a script with a cabal or stack header, as the executable named after it
+// in the package above with stack if the project has “stack.yaml” or with cabal otherwise, or as a standalone source with ghc.
+func (m *CabalScriptManager) findTarget(cmdBase string) (target *haskellTargetT, err error) {
 	defer Catch(&err)
-	dirPathPrev := exeLikePath
-	dirPath := filepath.Dir(exeLikePath)
-	for dirPath != dirPathPrev {
-		cabalFiles := V(filepath.Glob(filepath.Join(dirPath, "*.cabal")))
-		if len(cabalFiles) > 0 {
-			return cabalFiles[0], nil
+	exeLikePath := V(m.findExeLike(cmdBase))
+	target = &haskellTargetT{
+		cmdBase:     cmdBase,
+		exeLikePath: exeLikePath,
+	}
+	isDir := V(os.Stat(exeLikePath)).IsDir()
+	if !isDir && containsCabalScriptBlockStartMarker(exeLikePath) {
+		target.tool = "cabal"
+		return target, nil
+	}
+	if !isDir {
+		if stackScriptArgs := V(readStackScriptArgs(exeLikePath)); stackScriptArgs != nil {
+			target.tool = "stack"
+			target.stackScriptArgs = stackScriptArgs
+			return target, nil
 		}
-		dirPathPrev = dirPath
-		dirPath = filepath.Dir(dirPath)
 	}
-	return "", errors.New("no cabal file found")
+	if packageFilePath, err := findPackageFile(exeLikePath); err == nil {
+		target.packageFilePath = packageFilePath
+		if stackFilePath, err := findUpward(filepath.Dir(packageFilePath), "stack.yaml"); err == nil && E(stackCmd()) == nil {
+			target.tool = "stack"
+			target.stackFilePath = stackFilePath
+			return target, nil
+		}
+		if filepath.Ext(packageFilePath) == ".cabal" && E(cabalCmd()) == nil {
+			target.tool = "cabal"
+			return target, nil
+		}
+		return nil, errors.New(fmt.Sprintf("no build tool found for the package: %s", packageFilePath))
+	}
+	if E(ghcCmd()) == nil {
+		target.tool = "ghc"
+		return target, nil
+	}
+	return nil, errors.New("no matching cabal target found")
 }
 
-func build(cabalFilePath string, cmdBase string) (exePath string, err error) {
+func (m *CabalScriptManager) Run(args []string, shouldRebuild bool) (err error) {
 	defer Catch(&err)
-	cabalFileDir := filepath.Dir(cabalFilePath)
-	wd := V(os.Getwd())
-	defer (func() { Ignore(os.Chdir(wd)) })()
-	V0(os.Chdir(cabalFileDir))
-	cmd := exec.Command(V(cabalCmd()), "build", cmdBase)
-	readCloser := V(cmd.StdoutPipe())
-	defer (func() { Ignore(readCloser.Close()) })()
-	go (func() {
-		scanner := bufio.NewScanner(readCloser)
-		for {
-			if !scanner.Scan() {
-				break
-			}
-			txt := scanner.Text()
-			if !strings.Contains(txt, "Up to date") {
-				Ignore(os.Stderr.Write([]byte(txt + "\n")))
-			}
-		}
-	})()
+	_, exePath, err := ensureExeFile(V(m.findTarget(filepath.Base(args[0]))), shouldRebuild)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exePath, args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	V0(cmd.Run())
-	cmd = exec.Command(V(cabalCmd()), "list-bin", cmdBase)
-	bufExePath := V(cmd.Output())
-	builtExePath := strings.TrimSpace(string(bufExePath))
-	V0(os.Chdir(wd))
-	return builtExePath, nil
+	return common.RunCommand(cmd)
 }
 
-func (m *CabalScriptManager) Run(args []string, shouldRebuild bool) (err error) {
+func (m *CabalScriptManager) Build(cmdBase string, shouldRebuild bool) (err error) {
 	defer Catch(&err)
-	cmdBase := filepath.Base(args[0])
-	for _, exeLikePath := range m.exeLikePaths {
-		exeLikeBase := filepath.Base(exeLikePath)
-		stat, err := os.Stat(exeLikePath)
-		if err != nil {
-			continue
-		}
-		if stat.IsDir() {
-			if filepath.Base(exeLikePath) == cmdBase {
-				if cabalFilePath, err := findCabalFile(exeLikePath); err == nil {
-					builtExtPath := V(build(cabalFilePath, cmdBase))
-					cmd := exec.Command(builtExtPath, args[1:]...)
-					cmd.Stdin = os.Stdin
-					cmd.Stdout = os.Stdout
-					cmd.Stderr = os.Stderr
-					return cmd.Run()
-				} else {
-					return errors.New("no matching cabal target found")
-				}
-			}
-		} else {
-			for _, ext := range extensions {
-				if exeLikeBase == cmdBase+ext ||
-					exeLikeBase == common.Kebab2Camel(cmdBase)+ext {
-					if containsCabalScriptBlockStartMarker(exeLikePath) {
-						cmd := exec.Command(V(cabalCmd()), append([]string{"run", exeLikePath}, args[1:]...)...)
-						cmd.Stdin = os.Stdin
-						cmd.Stdout = os.Stdout
-						cmd.Stderr = os.Stderr
-						return cmd.Run()
-					} else if cabalFilePath, err := findCabalFile(exeLikePath); err == nil {
-						builtExePath := V(build(cabalFilePath, cmdBase))
-						cmd := exec.Command(builtExePath, args[1:]...)
-						cmd.Stdin = os.Stdin
-						cmd.Stdout = os.Stdout
-						cmd.Stderr = os.Stderr
-						return cmd.Run()
-					} else {
-						return errors.New("no matching cabal target found")
-					}
-				}
-			}
-		}
-	}
-	return errors.New(fmt.Sprintf("no matching hs file found: %s", args[0]))
+	_, _, err = ensureExeFile(V(m.findTarget(cmdBase)), shouldRebuild)
+	return err
 }
 
-var cabalCmd = sync.OnceValues(func() (cabalPath string, err error) {
+func (m *CabalScriptManager) CachedPath(cmdBase string) (cachedPath string, err error) {
 	defer Catch(&err)
-	return V(exec.LookPath("cabal")), nil
-})
+	_, cachedPath, err = exeBuildInfo(V(m.findTarget(cmdBase)))
+	return cachedPath, err
+}
+
+func (m *CabalScriptManager) LaunchStamp(cmdBase string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
+	defer Catch(&err)
+	buildInfo, exePath, err := ensureExeFile(V(m.findTarget(cmdBase)), shouldRebuild)
+	if err != nil {
+		return nil, err
+	}
+	return common.NewLaunchStamp([]string{exePath}, exePath, buildInfo, nil), nil
+}
 
 func newCabalScriptManager(dirPath string) common.Manager {
-	if E(cabalCmd()) != nil {
+	if E(cabalCmd()) != nil && E(stackCmd()) != nil && E(ghcCmd()) != nil {
 		return nil
 	}
 	var exeLikePaths []string
@@ -0,0 +1,151 @@
+package lib
+
+import (
+	"encoding/json"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// indexFileBase is the base name of the file in the links directory which persists the discovery index.
+const indexFileBase = ".index.json"
+
+// indexedCandidateT is a command found in a directory, recorded with the name of the factory which provides it.
+type indexedCandidateT struct {
+	Name       string `json:"name"`
+	SourcePath string `json:"source_path"`
+	Factory    string `json:"factory"`
+}
+
+// indexedDirT holds the commands found in a directory and the modification times of the directory and its subdirectories at the time.
+type indexedDirT struct {
+	Stamp map[string]int64 `json:"stamp"`
+	// Candidates are in the order of precedence of the factories.
+	Candidates []*indexedCandidateT `json:"candidates"`
+}
+
+// indexT is the discovery index which saves scanning every directory with every manager on each invocation.
+type indexT struct {
+	// Factories are the names of the factories the index was made with. The whole index is invalidated if they change.
+	Factories []string                `json:"factories"`
+	Dirs      map[string]*indexedDirT `json:"dirs"`
+}
+
+func indexFilePath() (path string, err error) {
+	defer Catch(&err)
+	return filepath.Join(V(common.LinksDirPath()), indexFileBase), nil
+}
+
+func factoryNames() (names []string) {
+	for _, factory := range common.Factories() {
+		names = append(names, factory.Name)
+	}
+	return names
+}
+
+func newIndex() *indexT {
+	return &indexT{
+		Factories: factoryNames(),
+		Dirs:      map[string]*indexedDirT{},
+	}
+}
+
+// loadIndex reads the persisted index. A missing, broken, or outdated one results in an empty index rather than an error.
+func loadIndex() (index *indexT) {
+	filePath, err := indexFilePath()
+	if err != nil {
+		return newIndex()
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return newIndex()
+	}
+	index = &indexT{}
+	if err := json.Unmarshal(data, index); err != nil ||
+		index.Dirs == nil ||
+		!slices.Equal(index.Factories, factoryNames()) {
+		return newIndex()
+	}
+	return index
+}
+
+func (index *indexT) save() (err error) {
+	defer Catch(&err)
+	return common.WriteFileAtomically(V(indexFilePath()), V(json.Marshal(index)), 0644)
+}
+
+// dirStamp returns the modification times of the directory and its immediate subdirectories,
+// which change when commands are added to or removed from the directory or from a package directory in it.
+func dirStamp(dirPath string) (stamp map[string]int64, err error) {
+	defer Catch(&err)
+	stamp = map[string]int64{
+		".": V(os.Stat(dirPath)).ModTime().UnixNano(),
+	}
+	for _, dirEntry := range V(os.ReadDir(dirPath)) {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		stat, err := os.Stat(filepath.Join(dirPath, dirEntry.Name()))
+		if err != nil {
+			continue
+		}
+		stamp[dirEntry.Name()] = stat.ModTime().UnixNano()
+	}
+	return stamp, nil
+}
+
+// scanDir finds the commands in the directory with the manager of every factory.
+func scanDir(dirPath string) (candidates []*indexedCandidateT) {
+	for _, factory := range common.Factories() {
+		manager := factory.NewManager(dirPath)
+		if manager == nil {
+			continue
+		}
+		for _, commandBaseInfo := range manager.GetCommandBaseInfoList() {
+			candidates = append(candidates, &indexedCandidateT{
+				Name:       commandBaseInfo.CmdBase,
+				SourcePath: commandBaseInfo.SourcePath,
+				Factory:    factory.Name,
+			})
+		}
+	}
+	return candidates
+}
+
+// refresh rescans the directories which have changed since they were indexed, or all of them if forced.
+// The directories which no longer exist are dropped. It reports if the index has changed.
+func (index *indexT) refresh(dirPaths []string, force bool) (changed bool, err error) {
+	defer Catch(&err)
+	for dirPath := range index.Dirs {
+		if _, err := os.Stat(dirPath); err != nil {
+			delete(index.Dirs, dirPath)
+			changed = true
+		}
+	}
+	for _, dirPath := range dirPaths {
+		stamp := V(dirStamp(dirPath))
+		if indexedDir, ok := index.Dirs[dirPath]; ok && !force && maps.Equal(indexedDir.Stamp, stamp) {
+			continue
+		}
+		index.Dirs[dirPath] = &indexedDirT{
+			Stamp:      stamp,
+			Candidates: scanDir(dirPath),
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// updatedIndex returns the index which is up-to-date for the directories, persisting it if it has changed.
+func updatedIndex(dirPaths []string, force bool) (index *indexT, err error) {
+	defer Catch(&err)
+	index = loadIndex()
+	if V(index.refresh(dirPaths, force)) {
+		// The index is only a cache, so failing to persist it, e.g. on a read-only home, is not fatal.
+		Ignore(index.save())
+	}
+	return index, nil
+}
@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"encoding/json"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The index is persisted on the first resolution, and a directory is rescanned when a command is added to it.
+func TestIndex(t *testing.T) {
+	homeDirPath := filepath.Join(t.TempDir(), "home")
+	common.SetHomeDirPath(homeDirPath)
+	common.ResetConfig()
+	defer common.ResetConfig()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	dirPath := filepath.Join(t.TempDir(), "bin")
+	V0(os.MkdirAll(dirPath, 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, "hello.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	t.Setenv("BINCPATH", dirPath)
+	resolution := V(resolve("hello"))
+	assert.Equal(t, filepath.Join(dirPath, "hello.go"), resolution.Winner.SourcePath)
+	var index indexT
+	V0(json.Unmarshal(V(os.ReadFile(V(indexFilePath()))), &index))
+	assert.Contains(t, index.Dirs, dirPath)
+	assert.Equal(t, "hello", index.Dirs[dirPath].Candidates[0].Name)
+
+	V0(os.WriteFile(filepath.Join(dirPath, "bye.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	resolution = V(resolve("bye"))
+	assert.Equal(t, filepath.Join(dirPath, "bye.go"), resolution.Winner.SourcePath)
+}
+
+// A stale entry in the index falls back to scanning the directories.
+func TestIndexStale(t *testing.T) {
+	homeDirPath := filepath.Join(t.TempDir(), "home")
+	common.SetHomeDirPath(homeDirPath)
+	common.ResetConfig()
+	defer common.ResetConfig()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	dirPath := filepath.Join(t.TempDir(), "bin")
+	V0(os.MkdirAll(dirPath, 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, "hello.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	t.Setenv("BINCPATH", dirPath)
+	index := newIndex()
+	index.Dirs[dirPath] = &indexedDirT{
+		Stamp: V(dirStamp(dirPath)),
+		Candidates: []*indexedCandidateT{
+			{Name: "ghost", SourcePath: filepath.Join(dirPath, "ghost.go"), Factory: "Go Main File Manager"},
+		},
+	}
+	V0(index.save())
+	_, err := resolve("ghost")
+	assert.Error(t, err)
+}
+
+// A command missing from the index, e.g. a script made executable, is found by scanning the directories.
+func TestIndexMissing(t *testing.T) {
+	homeDirPath := filepath.Join(t.TempDir(), "home")
+	common.SetHomeDirPath(homeDirPath)
+	common.ResetConfig()
+	defer common.ResetConfig()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	dirPath := filepath.Join(t.TempDir(), "bin")
+	V0(os.MkdirAll(dirPath, 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, "hello.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	t.Setenv("BINCPATH", dirPath)
+	index := newIndex()
+	index.Dirs[dirPath] = &indexedDirT{
+		Stamp:      V(dirStamp(dirPath)),
+		Candidates: []*indexedCandidateT{},
+	}
+	V0(index.save())
+	resolution := V(resolve("hello"))
+	assert.Equal(t, filepath.Join(dirPath, "hello.go"), resolution.Winner.SourcePath)
+}
@@ -0,0 +1,125 @@
+package java
+
+import (
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// jdkT is the pair of the compiler and the launcher of a JDK.
+type jdkT struct {
+	javacPath string
+	javaPath  string
+}
+
+// jdkToolPath returns the path of the tool in the “bin” directory of the JDK.
+func jdkToolPath(jdkHomePath string, name string) string {
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return filepath.Join(jdkHomePath, "bin", name)
+}
+
+// jdkOfHome returns the JDK in the directory, or nil if it has no compiler.
+func jdkOfHome(jdkHomePath string) *jdkT {
+	if jdkHomePath == "" {
+		return nil
+	}
+	if _, err := os.Stat(jdkToolPath(jdkHomePath, "javac")); err != nil {
+		return nil
+	}
+	return &jdkT{
+		javacPath: jdkToolPath(jdkHomePath, "javac"),
+		javaPath:  jdkToolPath(jdkHomePath, "java"),
+	}
+}
+
+var javacVersions sync.Map
+
+// javacVersion returns the version line of the compiler such as “javac 21.0.3”. JDK 8 writes it to the standard error.
+func javacVersion(javacPath string) (version string, err error) {
+	defer Catch(&err)
+	if version, ok := javacVersions.Load(javacPath); ok {
+		return version.(string), nil
+	}
+	output := string(V(exec.Command(javacPath, "-version").CombinedOutput()))
+	version, _, _ = strings.Cut(strings.TrimSpace(output), "\n")
+	version = strings.TrimSpace(version)
+	javacVersions.Store(javacPath, version)
+	return version, nil
+}
+
+// majorVersion returns the feature release of the version line such as 21 for “javac 21.0.3” and 8 for “javac 1.8.0_402”.
+func majorVersion(versionLine string) int {
+	version := versionLine[strings.LastIndex(versionLine, " ")+1:]
+	version = strings.TrimPrefix(version, "1.")
+	version, _, _ = strings.Cut(version, ".")
+	version, _, _ = strings.Cut(version, "-")
+	major, err := strconv.Atoi(version)
+	if err != nil {
+		return 0
+	}
+	return major
+}
+
+// versionMatches returns whether the JDK is of the requested version such as “17”, or of it or later with “17+”.
+func versionMatches(jdk *jdkT, requested string) bool {
+	versionLine, err := javacVersion(jdk.javacPath)
+	if err != nil {
+		return false
+	}
+	major := majorVersion(versionLine)
+	if strings.HasSuffix(requested, "+") {
+		minimum, err := strconv.Atoi(strings.TrimSuffix(requested, "+"))
+		return err == nil && major >= minimum
+	}
+	return strconv.Itoa(major) == requested
+}
+
+// defaultJdk returns the JDK configured with the tools, the one in $JAVA_HOME, or the one on $PATH.
+func defaultJdk() (jdk *jdkT, err error) {
+	defer Catch(&err)
+	return &jdkT{
+		javacPath: V(javacCommand()),
+		javaPath:  V(javaCommand()),
+	}, nil
+}
+
+// jdkEnvNames returns the environment variables which select the JDK of the version requested in the “//JAVA” directive.
+func jdkEnvNames(requested string) (envNames []string) {
+	envNames = []string{javaHomeEnvName}
+	if requested != "" {
+		envNames = append(envNames, "JAVA"+strings.TrimSuffix(requested, "+")+"_HOME")
+	}
+	return envNames
+}
+
+// findJdk returns the JDK of the version requested in the “//JAVA” directive. A JDK of a specific version is looked up in
+// the home directory configured as the tool “jdk<version>” or in $JAVA<version>_HOME, and the default one is used if it matches.
+func findJdk(requested string) (jdk *jdkT, err error) {
+	defer Catch(&err)
+	if requested == "" {
+		return defaultJdk()
+	}
+	version := strings.TrimSuffix(requested, "+")
+	for _, jdkHomePath := range []string{
+		common.ToolPath("jdk" + version),
+		os.Getenv("JAVA" + version + "_HOME"),
+	} {
+		if jdk := jdkOfHome(jdkHomePath); jdk != nil && versionMatches(jdk, requested) {
+			return jdk, nil
+		}
+	}
+	if jdk, err := defaultJdk(); err == nil && versionMatches(jdk, requested) {
+		return jdk, nil
+	}
+	return nil, errors.New(fmt.Sprintf("no JDK of version %s found; set JAVA%s_HOME or the tool “jdk%s”", requested, version, version))
+}
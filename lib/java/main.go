@@ -1,129 +1,228 @@
 package java
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/knaka/binc/lib/common"
 	. "github.com/knaka/go-utils"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 )
 
 type JavaClassManager struct {
-	javacCmd  string
-	javaCmd   string
-	filePaths []string
+	targetPaths []string
 }
 
 var _ common.Manager = &JavaClassManager{}
+var _ common.CacheChecker = &JavaClassManager{}
+var _ common.Builder = &JavaClassManager{}
+var _ common.FastLauncher = &JavaClassManager{}
 
 var extensions = []string{
 	".java",
 }
 
-func (m *JavaClassManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
-	for _, javaFilePath := range m.filePaths {
-		javaFileBase := filepath.Base(javaFilePath)
-		for _, ext := range extensions {
-			if strings.HasSuffix(javaFileBase, ext) {
-				infoList = append(infoList, &common.CommandBaseInfo{
-					CmdBase:    common.Camel2Kebab(javaFileBase[:len(javaFileBase)-len(ext)]),
-					SourcePath: javaFilePath,
-				})
-			}
+func (m *JavaClassManager) findTarget(cmdBase string) (targetPath string, err error) {
+	for _, targetPath := range m.targetPaths {
+		if cmdBaseOf(targetPath) == cmdBase {
+			return targetPath, nil
 		}
 	}
+	return "", errors.New(fmt.Sprintf("no matching java file found: %s", cmdBase))
+}
+
+func (m *JavaClassManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
+	for _, targetPath := range m.targetPaths {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    cmdBaseOf(targetPath),
+			SourcePath: targetPath,
+		})
+	}
 	return infoList
 }
 
 func (m *JavaClassManager) CanRun(cmdBase string) bool {
-	for _, hsFilePath := range m.filePaths {
-		for _, ext := range extensions {
-			if filepath.Base(hsFilePath) == common.Kebab2Camel(cmdBase)+ext {
-				return true
-			}
-		}
-	}
-	return false
+	_, err := m.findTarget(cmdBase)
+	return err == nil
 }
 
-func ensureClassFile(javaFilePath string, cmdBase string, shouldRebuild bool) (classFilePath string, err error) {
+// classesBuildInfo returns the build information of the sources and the jars, and the path of the cached directory of the class files for them.
+func classesBuildInfo(target *javaTargetT) (buildInfo *common.BuildInfo, classesDirPath string, err error) {
+	defer Catch(&err)
 	var fileInfoList []*common.FileInfo
-	fileInfoList = append(fileInfoList, V(common.GetFileInfo(javaFilePath)))
-	buildInfo := common.NewBuildInfo(
-		"",  // TODO: Decide if the version of Javac or Java should be recorded
-		nil, // Any arguments?
+	for _, filePath := range append(slices.Clone(target.sourcePaths), target.jarPaths...) {
+		fileInfoList = append(fileInfoList, V(common.GetFileInfo(filePath)))
+	}
+	var env []string
+	for _, name := range target.jdkEnvNames {
+		if value := os.Getenv(name); value != "" {
+			env = append(env, name+"="+value)
+		}
+	}
+	buildInfo = common.NewBuildInfo(
+		V(javacVersion(target.jdk.javacPath)),
+		common.BuildFlags("java", filepath.Dir(target.path)),
 		fileInfoList,
+		common.WithEnv(env),
 	)
-	classFilePath = V(common.CachedExePath(buildInfo.Hash, common.Kebab2Camel(cmdBase)+".class"))
-	if _, err = os.Stat(classFilePath); err != nil || shouldRebuild {
-		V0(os.MkdirAll(filepath.Dir(classFilePath), 0755))
-		cmd := exec.Command(V(javacCommand()), "-d", filepath.Dir(classFilePath), javaFilePath)
+	classesDirPath = V(common.CachedExePath(buildInfo.Hash, "classes"))
+	return buildInfo, classesDirPath, nil
+}
+
+// ensureBuiltClasses compiles the sources into the cache if they are not there, and returns the build information as well as the path of the directory of the class files.
+func ensureBuiltClasses(target *javaTargetT, shouldRebuild bool) (buildInfo *common.BuildInfo, classesDirPath string, err error) {
+	defer Catch(&err)
+	buildInfo, classesDirPath, err = classesBuildInfo(target)
+	if err != nil {
+		return nil, "", err
+	}
+	V0(common.EnsureBuilt(buildInfo, classesDirPath, shouldRebuild, func(tempPath string) error {
+		V0(os.MkdirAll(tempPath, 0755))
+		args := append(slices.Clone(buildInfo.Args), "-d", tempPath)
+		if len(target.jarPaths) > 0 {
+			args = append(args, "-cp", target.classPath(""))
+		}
+		cmd := exec.Command(target.jdk.javacPath, append(args, target.sourcePaths...)...)
 		cmd.Stdout = os.Stderr
 		cmd.Stderr = os.Stderr
-		V0(cmd.Run())
-		buildInfoJson := V(json.Marshal(buildInfo))
-		V0(os.WriteFile(V(common.InfoFilePath(buildInfo.Hash)), buildInfoJson, 0644))
-		log.Println("built:", classFilePath)
+		return cmd.Run()
+	}))
+	return buildInfo, classesDirPath, nil
+}
+
+// commandOf returns the command line to run the main class with the jars.
+func commandOf(target *javaTargetT, classesDirPath string) []string {
+	return []string{target.jdk.javaPath, "-cp", target.classPath(classesDirPath), target.mainClass}
+}
+
+// sourceLauncherCommand returns the command line to run the source with the source-file launcher, which compiles it in memory at every run.
+func sourceLauncherCommand(target *javaTargetT) []string {
+	command := []string{target.jdk.javaPath}
+	if len(target.jarPaths) > 0 {
+		command = append(command, "-cp", target.classPath(""))
+	}
+	return append(command, target.path)
+}
+
+func (m *JavaClassManager) Build(cmdBase string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	target := V(newJavaTarget(V(m.findTarget(cmdBase))))
+	if target.noCache {
+		return nil
+	}
+	_, _, err = ensureBuiltClasses(target, shouldRebuild)
+	return err
+}
+
+func (m *JavaClassManager) CachedPath(cmdBase string) (cachedPath string, err error) {
+	defer Catch(&err)
+	target := V(newJavaTarget(V(m.findTarget(cmdBase))))
+	if target.noCache {
+		return "", errors.New(fmt.Sprintf("not cached: %s", cmdBase))
+	}
+	_, cachedPath, err = classesBuildInfo(target)
+	return cachedPath, err
+}
+
+// LaunchStamp returns the stamp to launch the classes. The sources run with the source-file launcher are not supported as they have nothing cached.
+func (m *JavaClassManager) LaunchStamp(cmdBase string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
+	defer Catch(&err)
+	target := V(newJavaTarget(V(m.findTarget(cmdBase))))
+	if target.noCache {
+		return nil, common.ErrNoLaunchStamp
+	}
+	buildInfo, classesDirPath, err := ensureBuiltClasses(target, shouldRebuild)
+	if err != nil {
+		return nil, err
 	}
-	return classFilePath, nil
+	return common.NewLaunchStamp(
+		commandOf(target, classesDirPath),
+		classesDirPath,
+		buildInfo,
+		target.jdkEnvNames,
+		target.jdk.javacPath,
+		target.jdk.javaPath,
+	), nil
 }
 
 func (m *JavaClassManager) Run(args []string, shouldRebuild bool) (err error) {
 	defer Catch(&err)
-	cmdBase := filepath.Base(args[0])
-	for _, javaFilePath := range m.filePaths {
-		for _, ext := range extensions {
-			if filepath.Base(javaFilePath) == common.Kebab2Camel(cmdBase)+ext {
-				classFilePath := V(ensureClassFile(javaFilePath, cmdBase, shouldRebuild))
-				classDir := filepath.Dir(classFilePath)
-				classBase := common.Kebab2Camel(cmdBase)
-				cmd := exec.Command(m.javaCmd, append([]string{"-cp", classDir, classBase}, args[1:]...)...)
-				cmd.Stdin = os.Stdin
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				return cmd.Run()
-			}
+	target := V(newJavaTarget(V(m.findTarget(filepath.Base(args[0])))))
+	var command []string
+	if target.noCache {
+		command = sourceLauncherCommand(target)
+	} else {
+		_, classesDirPath, err := ensureBuiltClasses(target, shouldRebuild)
+		if err != nil {
+			return err
 		}
+		command = commandOf(target, classesDirPath)
 	}
-	return errors.New(fmt.Sprintf("no matching java file found: %s", args[0]))
+	cmd := exec.Command(command[0], append(command[1:], args[1:]...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return common.RunCommand(cmd)
 }
 
-var javacCommand = sync.OnceValues(func() (cabalPath string, err error) {
+// javaHomeEnvName is the environment variable which points to the default JDK.
+const javaHomeEnvName = "JAVA_HOME"
+
+var javacCommand = sync.OnceValues(func() (javacPath string, err error) {
 	defer Catch(&err)
+	if path := common.ToolPath("javac"); path != "" {
+		return path, nil
+	}
+	if jdk := jdkOfHome(os.Getenv(javaHomeEnvName)); jdk != nil {
+		return jdk.javacPath, nil
+	}
 	return V(exec.LookPath("javac")), nil
 })
 
-var javaCommand = sync.OnceValues(func() (cabalPath string, err error) {
+var javaCommand = sync.OnceValues(func() (javaPath string, err error) {
 	defer Catch(&err)
+	if path := common.ToolPath("java"); path != "" {
+		return path, nil
+	}
+	if jdk := jdkOfHome(os.Getenv(javaHomeEnvName)); jdk != nil {
+		return jdk.javaPath, nil
+	}
 	return V(exec.LookPath("java")), nil
 })
 
 func newJavaClassManager(dirPath string) common.Manager {
-	javacCmd, err := javacCommand()
-	if err != nil {
+	if _, err := javacCommand(); err != nil {
 		return nil
 	}
-	javaCmd, err := javaCommand()
-	if err != nil {
+	if _, err := javaCommand(); err != nil {
 		return nil
 	}
-	var matchedPaths []string
-	for _, ext := range extensions {
-		matchedPaths = append(matchedPaths, V(filepath.Glob(filepath.Join(dirPath, "*"+ext)))...)
+	var targetPaths []string
+	for _, dirEntry := range V(os.ReadDir(dirPath)) {
+		if strings.HasPrefix(dirEntry.Name(), "_") ||
+			strings.HasPrefix(dirEntry.Name(), ".") {
+			continue
+		}
+		targetPath := filepath.Join(dirPath, dirEntry.Name())
+		if !dirEntry.IsDir() {
+			if isSourceFile(targetPath) {
+				targetPaths = append(targetPaths, targetPath)
+			}
+			continue
+		}
+		if isCommandDir(targetPath) {
+			targetPaths = append(targetPaths, targetPath)
+		}
 	}
-	if len(matchedPaths) == 0 {
+	if len(targetPaths) == 0 {
 		return nil
 	}
 	return &JavaClassManager{
-		javacCmd:  javacCmd,
-		javaCmd:   javaCmd,
-		filePaths: matchedPaths,
+		targetPaths: targetPaths,
 	}
 }
 
@@ -0,0 +1,238 @@
+package java
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Directives in the comments of the sources such as “//DEPS com.google.code.gson:gson:2.11.0”, in the manner of JBang.
+const (
+	// depsDirectivePrefix declares the Maven coordinates of the dependencies.
+	depsDirectivePrefix = "//DEPS "
+	// javaDirectivePrefix requests the version of the JDK such as “17”, or “17+” for it or later.
+	javaDirectivePrefix = "//JAVA "
+	// noCacheDirective runs the source with the source-file launcher of JDK 11+ instead of compiling it into the cache.
+	noCacheDirective = "//NOCACHE"
+)
+
+// libDirBase is the base name of the directory next to the sources whose jars are on the class path.
+const libDirBase = "lib"
+
+var rePackage = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)\s*;`)
+})
+
+var reMainMethod = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`\b(?:public\s+static|static\s+public)\s+void\s+main\s*\(`)
+})
+
+// javaTargetT is a command made of a source file or of the sources in a directory.
+type javaTargetT struct {
+	path        string
+	cmdBase     string
+	sourcePaths []string
+	// mainClass is the fully qualified name of the class with the main method.
+	mainClass string
+	// jarPaths are the jars in the “lib” directory and the ones of the dependencies in the local Maven repository.
+	jarPaths []string
+	jdk      *jdkT
+	// jdkEnvNames are the environment variables which select the JDK.
+	jdkEnvNames []string
+	// noCache is whether the source is run with the source-file launcher. It is available only for a single file.
+	noCache bool
+}
+
+func cmdBaseOf(targetPath string) string {
+	base := filepath.Base(targetPath)
+	for _, ext := range extensions {
+		if strings.HasSuffix(base, ext) {
+			return common.Camel2Kebab(base[:len(base)-len(ext)])
+		}
+	}
+	return base
+}
+
+func isSourceFile(filePath string) bool {
+	for _, ext := range extensions {
+		if strings.HasSuffix(filePath, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// dirSourceFiles returns the sources in the directory and in its subdirectories for the packages, except in the “lib” directory.
+func dirSourceFiles(dirPath string) (filePaths []string, err error) {
+	err = filepath.WalkDir(dirPath, func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirEntry.IsDir() {
+			if path != dirPath && (dirEntry.Name() == libDirBase || strings.HasPrefix(dirEntry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isSourceFile(path) {
+			filePaths = append(filePaths, path)
+		}
+		return nil
+	})
+	return filePaths, err
+}
+
+// Files of the build tools whose projects are not commands, even with the sources in them.
+var buildToolFileBases = []string{
+	"pom.xml",
+	"build.gradle",
+	"build.gradle.kts",
+	"settings.gradle",
+	"settings.gradle.kts",
+}
+
+// isCommandDir checks if the directory is a command: it has sources directly in it or under “src”,
+// and it is not a project of Maven or Gradle.
+func isCommandDir(dirPath string) bool {
+	for _, base := range buildToolFileBases {
+		if _, err := os.Stat(filepath.Join(dirPath, base)); err == nil {
+			return false
+		}
+	}
+	for _, ext := range extensions {
+		if filePaths, err := filepath.Glob(filepath.Join(dirPath, "*"+ext)); err == nil && len(filePaths) > 0 {
+			return true
+		}
+	}
+	sourcePaths, err := dirSourceFiles(filepath.Join(dirPath, "src"))
+	return err == nil && len(sourcePaths) > 0
+}
+
+// mavenRepositoryPath returns the path of the local Maven repository.
+func mavenRepositoryPath() string {
+	if path := common.ToolPath("maven_repository"); path != "" {
+		return path
+	}
+	return common.ExpandHome("~/.m2/repository")
+}
+
+// mavenJarPath returns the path of the jar of the coordinates “group:artifact:version” in the local Maven repository.
+func mavenJarPath(coordinates string) (jarPath string, err error) {
+	parts := strings.Split(coordinates, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", errors.New(fmt.Sprintf("invalid Maven coordinates: %s", coordinates))
+	}
+	group, artifact, version := parts[0], parts[1], parts[2]
+	jarPath = filepath.Join(
+		append([]string{mavenRepositoryPath()}, strings.Split(group, ".")...)...,
+	)
+	jarPath = filepath.Join(jarPath, artifact, version, artifact+"-"+version+".jar")
+	if _, err := os.Stat(jarPath); err != nil {
+		return "", errors.New(fmt.Sprintf("%s is not in the local Maven repository; fetch it with `mvn dependency:get -Dartifact=%s`", coordinates, coordinates))
+	}
+	return jarPath, nil
+}
+
+// directivesT is what the directives of the sources declare.
+type directivesT struct {
+	// deps are the Maven coordinates of the dependencies. The transitive dependencies have to be listed as well.
+	deps        []string
+	javaVersion string
+	noCache     bool
+}
+
+// readDirectives adds the directives of the source to the ones read so far.
+func (d *directivesT) readDirectives(filePath string) (err error) {
+	defer Catch(&err)
+	in := V(os.Open(filePath))
+	defer (func() { Ignore(in.Close()) })()
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, depsDirectivePrefix):
+			d.deps = append(d.deps, strings.FieldsFunc(line[len(depsDirectivePrefix):], func(r rune) bool {
+				return r == ' ' || r == '\t' || r == ','
+			})...)
+		case strings.HasPrefix(line, javaDirectivePrefix):
+			d.javaVersion = strings.TrimSpace(line[len(javaDirectivePrefix):])
+		case line == noCacheDirective:
+			d.noCache = true
+		}
+	}
+	return scanner.Err()
+}
+
+// findMainClass returns the fully qualified name of the main class: the one of the source named after the command,
+// or of the only source with a main method in a directory.
+func findMainClass(sourcePaths []string, cmdBase string) (mainClass string, err error) {
+	defer Catch(&err)
+	var candidates []string
+	for _, sourcePath := range sourcePaths {
+		source := string(V(os.ReadFile(sourcePath)))
+		if !reMainMethod().MatchString(source) {
+			continue
+		}
+		className := strings.TrimSuffix(filepath.Base(sourcePath), filepath.Ext(sourcePath))
+		if match := rePackage().FindStringSubmatch(source); match != nil {
+			className = match[1] + "." + className
+		}
+		if len(sourcePaths) == 1 || common.Camel2Kebab(strings.TrimSuffix(filepath.Base(sourcePath), filepath.Ext(sourcePath))) == cmdBase {
+			return className, nil
+		}
+		candidates = append(candidates, className)
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	if len(candidates) == 0 {
+		return "", errors.New(fmt.Sprintf("no main class found: %s", cmdBase))
+	}
+	return "", errors.New(fmt.Sprintf("multiple main classes found: %s: %s", cmdBase, strings.Join(candidates, ", ")))
+}
+
+func newJavaTarget(targetPath string) (target *javaTargetT, err error) {
+	defer Catch(&err)
+	target = &javaTargetT{
+		path:    targetPath,
+		cmdBase: cmdBaseOf(targetPath),
+	}
+	libDirPath := filepath.Join(filepath.Dir(targetPath), libDirBase)
+	isDir := V(os.Stat(targetPath)).IsDir()
+	if isDir {
+		target.sourcePaths = V(dirSourceFiles(targetPath))
+		libDirPath = filepath.Join(targetPath, libDirBase)
+	} else {
+		target.sourcePaths = []string{targetPath}
+	}
+	target.mainClass = V(findMainClass(target.sourcePaths, target.cmdBase))
+	target.jarPaths = V(filepath.Glob(filepath.Join(libDirPath, "*.jar")))
+	directives := &directivesT{}
+	for _, sourcePath := range target.sourcePaths {
+		V0(directives.readDirectives(sourcePath))
+	}
+	for _, coordinates := range directives.deps {
+		target.jarPaths = append(target.jarPaths, V(mavenJarPath(coordinates)))
+	}
+	target.jdk = V(findJdk(directives.javaVersion))
+	target.jdkEnvNames = jdkEnvNames(directives.javaVersion)
+	target.noCache = directives.noCache && !isDir
+	return target, nil
+}
+
+// classPath returns the class path to compile against the jars, and to run the classes as well if the directory is given.
+func (t *javaTargetT) classPath(classesDirPath string) string {
+	var paths []string
+	if classesDirPath != "" {
+		paths = append(paths, classesDirPath)
+	}
+	return strings.Join(append(paths, t.jarPaths...), string(os.PathListSeparator))
+}
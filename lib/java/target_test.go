@@ -0,0 +1,131 @@
+package java
+
+import (
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// writeFakeJdk creates a JDK in the directory whose compiler only reports the version.
+func writeFakeJdk(jdkHomePath string, version string) string {
+	V0(os.MkdirAll(filepath.Join(jdkHomePath, "bin"), 0755))
+	V0(os.WriteFile(filepath.Join(jdkHomePath, "bin", "javac"), []byte(fmt.Sprintf("#!/bin/sh\necho javac %s\n", version)), 0755))
+	V0(os.WriteFile(filepath.Join(jdkHomePath, "bin", "java"), []byte("#!/bin/sh\n"), 0755))
+	return jdkHomePath
+}
+
+// setDefaultJdk points $JAVA_HOME to a fake JDK 21 once, as the default JDK is looked up only once.
+var setDefaultJdk = sync.OnceFunc(func() {
+	V0(os.Setenv(javaHomeEnvName, writeFakeJdk(V(os.MkdirTemp("", "jdk")), "21.0.3")))
+})
+
+func TestNewJavaTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no shell scripts")
+	}
+	setDefaultJdk()
+	dirPath := t.TempDir()
+	cmdDirPath := filepath.Join(dirPath, "word-count")
+	V0(os.MkdirAll(filepath.Join(cmdDirPath, "com", "example", "util"), 0755))
+	V0(os.MkdirAll(filepath.Join(cmdDirPath, "lib"), 0755))
+	V0(os.WriteFile(filepath.Join(cmdDirPath, "com", "example", "WordCount.java"), []byte(`package com.example;
+
+import com.example.util.Words;
+
+public class WordCount {
+    public static void main(String[] args) {
+        System.out.println(Words.count(args));
+    }
+}
+`), 0644))
+	V0(os.WriteFile(filepath.Join(cmdDirPath, "com", "example", "util", "Words.java"), []byte(`package com.example.util;
+
+public class Words {
+    public static int count(String[] args) { return args.length; }
+}
+`), 0644))
+	V0(os.WriteFile(filepath.Join(cmdDirPath, "lib", "dep.jar"), nil, 0644))
+	V0(os.WriteFile(filepath.Join(cmdDirPath, "lib", "Ignored.java"), nil, 0644))
+
+	target := V(newJavaTarget(cmdDirPath))
+	assert.Equal(t, "word-count", target.cmdBase)
+	assert.Equal(t, "com.example.WordCount", target.mainClass)
+	assert.Len(t, target.sourcePaths, 2)
+	assert.Equal(t, []string{filepath.Join(cmdDirPath, "lib", "dep.jar")}, target.jarPaths)
+	assert.Equal(t, "classes"+string(os.PathListSeparator)+filepath.Join(cmdDirPath, "lib", "dep.jar"), target.classPath("classes"))
+
+	filePath := filepath.Join(dirPath, "HelloWorld.java")
+	V0(os.WriteFile(filePath, []byte("//DEPS com.google.code.gson:gson:2.11.0, org.slf4j:slf4j-api:2.0.13\n//JAVA 17+\n//NOCACHE\nclass HelloWorld { public static void main(String[] args) {} }\n"), 0644))
+	directives := &directivesT{}
+	V0(directives.readDirectives(filePath))
+	assert.Equal(t, []string{"com.google.code.gson:gson:2.11.0", "org.slf4j:slf4j-api:2.0.13"}, directives.deps)
+	assert.Equal(t, "17+", directives.javaVersion)
+	assert.True(t, directives.noCache)
+	assert.Equal(t, "HelloWorld", V(findMainClass([]string{filePath}, "hello-world")))
+
+	_, err := mavenJarPath("com.google.code.gson:gson")
+	assert.Error(t, err)
+}
+
+func TestFindJdk(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no shell scripts")
+	}
+	setDefaultJdk()
+	jdk17HomePath := writeFakeJdk(t.TempDir(), "17.0.11")
+	t.Setenv("JAVA17_HOME", jdk17HomePath)
+	assert.Equal(t, jdkToolPath(jdk17HomePath, "javac"), V(findJdk("17")).javacPath)
+	assert.Equal(t, V(javacCommand()), V(findJdk("21+")).javacPath)
+	assert.Equal(t, V(javacCommand()), V(findJdk("")).javacPath)
+	_, err := findJdk("11")
+	assert.Error(t, err)
+	assert.Equal(t, "javac 17.0.11", V(javacVersion(jdkToolPath(jdk17HomePath, "javac"))))
+	assert.Equal(t, 8, majorVersion("javac 1.8.0_402"))
+}
+
+// A directory is a command with the sources directly in it or under “src”, unless it is a project of a build tool.
+func TestIsCommandDir(t *testing.T) {
+	dirPath := t.TempDir()
+	writeSource := func(relPath string) {
+		V0(os.MkdirAll(filepath.Join(dirPath, filepath.Dir(relPath)), 0755))
+		V0(os.WriteFile(filepath.Join(dirPath, relPath), nil, 0644))
+	}
+	writeSource(filepath.Join("tool", "Tool.java"))
+	writeSource(filepath.Join("app", "src", "com", "example", "App.java"))
+	writeSource(filepath.Join("maven-project", "pom.xml"))
+	writeSource(filepath.Join("maven-project", "src", "main", "java", "Main.java"))
+	writeSource(filepath.Join("gradle-project", "build.gradle.kts"))
+	writeSource(filepath.Join("gradle-project", "Main.java"))
+	writeSource(filepath.Join("docs", "examples", "Example.java"))
+	assert.True(t, isCommandDir(filepath.Join(dirPath, "tool")))
+	assert.True(t, isCommandDir(filepath.Join(dirPath, "app")))
+	assert.False(t, isCommandDir(filepath.Join(dirPath, "maven-project")))
+	assert.False(t, isCommandDir(filepath.Join(dirPath, "gradle-project")))
+	assert.False(t, isCommandDir(filepath.Join(dirPath, "docs")))
+}
+
+// Switching the JDK selected by the environment changes the cache entry, even of the same version.
+func TestClassesBuildInfoJdk(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no shell scripts")
+	}
+	setDefaultJdk()
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	filePath := filepath.Join(t.TempDir(), "Hello.java")
+	V0(os.WriteFile(filePath, []byte("//JAVA 17\nclass Hello { public static void main(String[] args) {} }\n"), 0644))
+	t.Setenv("JAVA17_HOME", writeFakeJdk(t.TempDir(), "17.0.11"))
+	target := V(newJavaTarget(filePath))
+	assert.Equal(t, []string{javaHomeEnvName, "JAVA17_HOME"}, target.jdkEnvNames)
+	buildInfo, _, err := classesBuildInfo(target)
+	V0(err)
+	t.Setenv("JAVA17_HOME", writeFakeJdk(t.TempDir(), "17.0.11"))
+	otherBuildInfo, _, err := classesBuildInfo(V(newJavaTarget(filePath)))
+	V0(err)
+	assert.NotEqual(t, buildInfo.HashStr, otherBuildInfo.HashStr)
+}
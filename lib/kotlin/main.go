@@ -0,0 +1,240 @@
+package kotlin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/samber/lo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Sort in descending order of length.
+var extensions = []string{
+	".main.kts",
+	".kt",
+}
+
+const scriptExt = ".main.kts"
+
+// scriptCacheEnvName is the environment variable which tells the runner where to cache the compiled scripts.
+const scriptCacheEnvName = "KOTLIN_MAIN_KTS_COMPILED_SCRIPTS_CACHE_DIR"
+
+func cmdBaseOf(filePath string) string {
+	fileBase := filepath.Base(filePath)
+	for _, ext := range extensions {
+		if strings.HasSuffix(fileBase, ext) {
+			return common.Camel2Kebab(fileBase[:len(fileBase)-len(ext)])
+		}
+	}
+	return ""
+}
+
+// cacheBuildInfo returns the build information of the source file and the path of the cached artifact for it:
+// a jar including the runtime for a source, or a directory where the runner caches the compiled script.
+func cacheBuildInfo(filePath string, cmdBase string) (buildInfo *common.BuildInfo, cachedPath string, err error) {
+	defer Catch(&err)
+	buildInfo = common.NewBuildInfo(
+		V(kotlincVersion()),
+		common.BuildFlags("kotlin", filepath.Dir(filePath)),
+		[]*common.FileInfo{V(common.GetFileInfo(filePath))},
+	)
+	cachedPath = V(common.CachedExePath(buildInfo.Hash, Ternary(strings.HasSuffix(filePath, scriptExt), "scripts", cmdBase+".jar")))
+	return buildInfo, cachedPath, nil
+}
+
+func ensureCached(filePath string, cmdBase string, shouldRebuild bool) (buildInfo *common.BuildInfo, cachedPath string, err error) {
+	defer Catch(&err)
+	buildInfo, cachedPath, err = cacheBuildInfo(filePath, cmdBase)
+	if err != nil {
+		return nil, "", err
+	}
+	V0(common.EnsureBuilt(buildInfo, cachedPath, shouldRebuild, func(tempPath string) error {
+		// A script is compiled by the runner at the first run, which caches it in the directory.
+		if strings.HasSuffix(filePath, scriptExt) {
+			return os.MkdirAll(tempPath, 0755)
+		}
+		// kotlinc writes a jar only to a path ending in “.jar”, and a directory of class files to any other.
+		jarPath := tempPath + ".jar"
+		defer (func() { Ignore(os.Remove(jarPath)) })()
+		args := append(slices.Clone(buildInfo.Args), "-include-runtime", "-d", jarPath, filePath)
+		cmd := exec.Command(V(kotlincCommand()), args...)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+		return os.Rename(jarPath, tempPath)
+	}))
+	return buildInfo, cachedPath, nil
+}
+
+// --------
+
+type KotlinManager struct {
+	javaCmd   string
+	filePaths []string
+}
+
+var _ common.Manager = &KotlinManager{}
+var _ common.CacheChecker = &KotlinManager{}
+var _ common.Builder = &KotlinManager{}
+var _ common.FastLauncher = &KotlinManager{}
+
+func (m *KotlinManager) findSource(cmdBase string) (filePath string, err error) {
+	for _, filePath := range m.filePaths {
+		if cmdBaseOf(filePath) == cmdBase {
+			return filePath, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("no matching kotlin file found: %s", cmdBase))
+}
+
+func (m *KotlinManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
+	for _, filePath := range m.filePaths {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    cmdBaseOf(filePath),
+			SourcePath: filePath,
+		})
+	}
+	return infoList
+}
+
+func (m *KotlinManager) CanRun(cmdBase string) bool {
+	_, err := m.findSource(cmdBase)
+	return err == nil
+}
+
+// command returns the command line to run the cached artifact.
+func (m *KotlinManager) command(filePath string, cachedPath string) (command []string, err error) {
+	defer Catch(&err)
+	if !strings.HasSuffix(filePath, scriptExt) {
+		return []string{m.javaCmd, "-jar", cachedPath}, nil
+	}
+	if kotlinCmd, err := kotlinCommand(); err == nil {
+		return []string{kotlinCmd, filePath}, nil
+	}
+	return []string{V(kotlincCommand()), "-script", filePath}, nil
+}
+
+func (m *KotlinManager) Run(args []string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	cmdBase := filepath.Base(args[0])
+	filePath := V(m.findSource(cmdBase))
+	_, cachedPath, err := ensureCached(filePath, cmdBase, shouldRebuild)
+	if err != nil {
+		return err
+	}
+	command := V(m.command(filePath, cachedPath))
+	cmd := exec.Command(command[0], append(command[1:], args[1:]...)...)
+	if strings.HasSuffix(filePath, scriptExt) {
+		cmd.Env = append(os.Environ(), scriptCacheEnvName+"="+cachedPath)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return common.RunCommand(cmd)
+}
+
+func (m *KotlinManager) Build(cmdBase string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	_, _, err = ensureCached(V(m.findSource(cmdBase)), cmdBase, shouldRebuild)
+	return err
+}
+
+func (m *KotlinManager) CachedPath(cmdBase string) (cachedPath string, err error) {
+	defer Catch(&err)
+	_, cachedPath, err = cacheBuildInfo(V(m.findSource(cmdBase)), cmdBase)
+	return cachedPath, err
+}
+
+// LaunchStamp returns the stamp to launch a jar. Scripts are not supported as they are run with an environment variable.
+func (m *KotlinManager) LaunchStamp(cmdBase string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
+	defer Catch(&err)
+	filePath := V(m.findSource(cmdBase))
+	if strings.HasSuffix(filePath, scriptExt) {
+		return nil, common.ErrNoLaunchStamp
+	}
+	buildInfo, jarPath, err := ensureCached(filePath, cmdBase, shouldRebuild)
+	if err != nil {
+		return nil, err
+	}
+	return common.NewLaunchStamp(
+		V(m.command(filePath, jarPath)),
+		jarPath,
+		buildInfo,
+		nil,
+		V(kotlincCommand()),
+		m.javaCmd,
+	), nil
+}
+
+var kotlincCommand = sync.OnceValues(func() (kotlincPath string, err error) {
+	defer Catch(&err)
+	if path := common.ToolPath("kotlinc"); path != "" {
+		return path, nil
+	}
+	return V(exec.LookPath("kotlinc")), nil
+})
+
+var kotlinCommand = sync.OnceValues(func() (kotlinPath string, err error) {
+	defer Catch(&err)
+	if path := common.ToolPath("kotlin"); path != "" {
+		return path, nil
+	}
+	return V(exec.LookPath("kotlin")), nil
+})
+
+var javaCommand = sync.OnceValues(func() (javaPath string, err error) {
+	defer Catch(&err)
+	if path := common.ToolPath("java"); path != "" {
+		return path, nil
+	}
+	return V(exec.LookPath("java")), nil
+})
+
+// kotlincVersion returns the version line of the compiler such as “info: kotlinc-jvm 2.0.0 (JRE 21.0.3+9)”, which is written to the standard error.
+var kotlincVersion = sync.OnceValues(func() (version string, err error) {
+	defer Catch(&err)
+	output := string(V(exec.Command(V(kotlincCommand()), "-version").CombinedOutput()))
+	version, _, _ = strings.Cut(strings.TrimSpace(output), "\n")
+	return version, nil
+})
+
+func newKotlinManager(dirPath string) common.Manager {
+	if _, err := kotlincCommand(); err != nil {
+		return nil
+	}
+	javaCmd, err := javaCommand()
+	if err != nil {
+		return nil
+	}
+	var filePaths []string
+	for _, ext := range extensions {
+		filePaths = append(filePaths, V(filepath.Glob(filepath.Join(dirPath, "*"+ext)))...)
+	}
+	filePaths = lo.Filter(filePaths, func(filePath string, _ int) bool {
+		return !strings.HasPrefix(filepath.Base(filePath), "_") &&
+			!strings.HasPrefix(filepath.Base(filePath), ".")
+	})
+	if len(filePaths) == 0 {
+		return nil
+	}
+	return &KotlinManager{
+		javaCmd:   javaCmd,
+		filePaths: filePaths,
+	}
+}
+
+func init() {
+	common.RegisterManagerFactory(
+		"Kotlin Manager",
+		newKotlinManager,
+		50,
+	)
+}
@@ -0,0 +1,47 @@
+package kotlin
+
+import (
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCmdBaseOf(t *testing.T) {
+	assert.Equal(t, "hello-world", cmdBaseOf("/bin/HelloWorld.kt"))
+	assert.Equal(t, "fetch-issues", cmdBaseOf("/bin/FetchIssues.main.kts"))
+	assert.Equal(t, "hello", cmdBaseOf("/bin/hello.kt"))
+}
+
+// fakeKotlinc writes a jar only to a path ending in “.jar” and a directory of class files to any other, as kotlinc does.
+const fakeKotlinc = `#!/bin/sh
+if [ "$1" = -version ]; then
+  echo "info: kotlinc-jvm 0.0.0 (fake)" >&2
+  exit 0
+fi
+while [ $# -gt 0 ]; do
+  if [ "$1" = -d ]; then out="$2"; fi
+  shift
+done
+case "$out" in
+*.jar) echo PK > "$out" ;;
+*) mkdir -p "$out" ;;
+esac
+`
+
+// The cached artifact of a source is a jar file, which “java -jar” runs.
+func TestEnsureCached(t *testing.T) {
+	common.InstallFakeTool(t, "kotlinc", fakeKotlinc)
+	filePath := filepath.Join(t.TempDir(), "Hello.kt")
+	V0(os.WriteFile(filePath, []byte("fun main() = println(\"Hello\")\n"), 0644))
+
+	_, jarPath, err := ensureCached(filePath, "hello", false)
+	V0(err)
+	assert.Equal(t, "hello.jar", filepath.Base(jarPath))
+	assert.True(t, V(os.Stat(jarPath)).Mode().IsRegular())
+	assert.Equal(t, "PK\n", string(V(os.ReadFile(jarPath))))
+	matches := V(filepath.Glob(filepath.Join(filepath.Dir(jarPath), "*.tmp-*")))
+	assert.Empty(t, matches)
+}
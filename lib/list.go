@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+type listEntryT struct {
+	Name       string `json:"name"`
+	Manager    string `json:"manager"`
+	SourcePath string `json:"source_path"`
+	// Cached is nil if the manager does not build the command into the cache.
+	Cached   *bool `json:"cached"`
+	Shadowed bool  `json:"shadowed"`
+}
+
+// listEntries returns all the commands discovered in $BINCPATH. The active source of each command comes first, followed by the sources it shadows.
+func listEntries() (entries []*listEntryT, err error) {
+	defer Catch(&err)
+	for _, resolution := range V(resolveAll()) {
+		for _, candidate := range append([]*candidateT{resolution.Winner}, resolution.Shadowed...) {
+			entry := &listEntryT{
+				Name:       candidate.Name,
+				Manager:    candidate.Factory.Name,
+				SourcePath: candidate.SourcePath,
+				Shadowed:   candidate != resolution.Winner,
+			}
+			if cacheChecker, ok := candidate.Manager.(common.CacheChecker); ok {
+				if cachedPath, err := cacheChecker.CachedPath(candidate.Name); err == nil {
+					_, err := os.Stat(cachedPath)
+					entry.Cached = Ptr(err == nil)
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// list prints every discovered command with the manager which owns it.
+func list(args []string, out io.Writer) (err error) {
+	defer Catch(&err)
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	jsonOutput := flags.Bool("json", false, "output in JSON")
+	V0(flags.Parse(args))
+	entries := V(listEntries())
+	if *jsonOutput {
+		if entries == nil {
+			entries = []*listEntryT{}
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	V0(fmt.Fprintln(writer, "NAME\tMANAGER\tSOURCE\tCACHED\tSHADOWED"))
+	for _, entry := range entries {
+		cached := "-"
+		if entry.Cached != nil {
+			cached = Ternary(*entry.Cached, "yes", "no")
+		}
+		V0(fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n",
+			entry.Name,
+			entry.Manager,
+			entry.SourcePath,
+			cached,
+			Ternary(entry.Shadowed, "yes", "no"),
+		))
+	}
+	return writer.Flush()
+}
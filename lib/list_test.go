@@ -0,0 +1,33 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	t.Setenv("BINCPATH", filepath.Join("golang", "testdata", "prj", "cmd"))
+	var buf bytes.Buffer
+	V0(list([]string{"--json"}, &buf))
+	var entries []*listEntryT
+	V0(json.Unmarshal(buf.Bytes(), &entries))
+	entry, found := lo.Find(entries, func(entry *listEntryT) bool {
+		return entry.Name == "say_hello"
+	})
+	assert.True(t, found)
+	assert.Equal(t, "Go Main File Manager", entry.Manager)
+	assert.Equal(t, filepath.Join("golang", "testdata", "prj", "cmd", "say_hello.go"), entry.SourcePath)
+	assert.NotNil(t, entry.Cached)
+	assert.False(t, *entry.Cached)
+	assert.False(t, entry.Shadowed)
+	assert.True(t, lo.ContainsBy(entries, func(entry *listEntryT) bool {
+		return entry.Name == "greet"
+	}))
+}
@@ -8,22 +8,29 @@ import (
 	"github.com/h2non/filetype/types"
 	"github.com/knaka/binc/lib/common"
 	. "github.com/knaka/go-utils"
-	"github.com/samber/lo"
 	"io"
 	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"slices"
+	"sort"
 	"strings"
 	"time"
 
 	// Load all the language managers.
+	_ "github.com/knaka/binc/lib/cc"
 	_ "github.com/knaka/binc/lib/golang"
 	_ "github.com/knaka/binc/lib/haskell"
 	_ "github.com/knaka/binc/lib/java"
+	_ "github.com/knaka/binc/lib/kotlin"
+	_ "github.com/knaka/binc/lib/nim"
+	_ "github.com/knaka/binc/lib/node"
+	_ "github.com/knaka/binc/lib/python"
 	_ "github.com/knaka/binc/lib/rust"
 	_ "github.com/knaka/binc/lib/scala"
+	_ "github.com/knaka/binc/lib/shebang"
+	_ "github.com/knaka/binc/lib/zig"
 )
 
 //go:generate -command mockgen go run github.com/knaka/go-run-cache@latest go.uber.org/mock/mockgen@latest
@@ -37,57 +44,26 @@ const appBase = "binc"
 
 var copiedBase = fmt.Sprintf(".%s", appBase)
 
-func iterateOverManagers(
-	fn func(manager common.Manager) error,
-	lastError error,
-) (err error) {
-	defer Catch(&err)
-	bincPathEnv := os.Getenv("BINCPATH")
-	bincDirPaths := lo.Filter(strings.Split(bincPathEnv, ":"), func(dir string, _ int) bool {
-		stat, err := os.Stat(dir)
-		return err == nil && stat.IsDir()
-	})
-	for _, factory := range common.Factories() {
-		for _, dirPath := range bincDirPaths {
-			if stat, err := os.Stat(dirPath); err != nil || !stat.IsDir() {
-				continue
-			}
-			manager := factory.NewManager(dirPath)
-			if manager == nil {
-				continue
-			}
-			//V0(fn(manager))
-			err = fn(manager)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	return lastError
-}
-
 func which(cmdBase string) (err error) {
-	return iterateOverManagers(func(manager common.Manager) (err error) {
-		for _, commandBaseInfo := range manager.GetCommandBaseInfoList() {
-			if commandBaseInfo.CmdBase == cmdBase {
-				fmt.Println(commandBaseInfo.SourcePath)
-				return nil
-			}
-		}
-		return nil
-	}, nil)
+	defer Catch(&err)
+	fmt.Println(V(resolveCommandOrAlias(cmdBase)).Winner.SourcePath)
+	return nil
 }
 
-// Average number of launches between cleanups
-const cleanupCycle = 100
+// Average number of launches between cleanups, unless configured otherwise
+const cleanupCycle = common.DefaultCleanupCycle
 
-// Number of days after which a binary is considered old
-const cleanupThresholdDays = 90
+// Number of days without use after which a binary is considered old, unless configured otherwise
+const cleanupThresholdDays = common.DefaultCleanupThresholdDays
 
 type randIntNFnT func(int) int
 
 type optionsT struct {
-	randIntNFn randIntNFnT
+	randIntNFn    randIntNFnT
+	cycle         int
+	thresholdDays int
+	// maxSize is the budget of the total size of the cache in bytes. Zero means unlimited.
+	maxSize int64
 }
 
 type optSetterFnT func(*optionsT)
@@ -99,37 +75,43 @@ func withRandFn(fn randIntNFnT) optSetterFnT {
 	}
 }
 
-// cleanupOldBinaries removes old binaries from the cache directory occasionally.
+func withCleanupConfig(cleanupConfig common.CleanupConfig) optSetterFnT {
+	return func(opts *optionsT) {
+		opts.cycle = cleanupConfig.Cycle
+		opts.thresholdDays = cleanupConfig.ThresholdDays
+		if cleanupConfig.MaxSize != "" {
+			opts.maxSize = V(parseSize(cleanupConfig.MaxSize))
+		}
+	}
+}
+
+// cleanupOldBinaries removes the binaries not used recently from the cache directory occasionally,
+// and then the least recently used ones while the total size of the cache exceeds the budget.
 func cleanupOldBinaries(
 	cacheRootDirPath string,
 	optSetterFnS ...optSetterFnT,
 ) (err error) {
 	defer Catch(&err)
 	options := optionsT{
-		randIntNFn: rand.Intn,
+		randIntNFn:    rand.Intn,
+		cycle:         cleanupCycle,
+		thresholdDays: cleanupThresholdDays,
 	}
 	for _, optSetterFn := range optSetterFnS {
 		optSetterFn(&options)
 	}
-	if options.randIntNFn(cleanupCycle) != 0 {
+	if options.cycle <= 0 || options.randIntNFn(options.cycle) != 0 {
 		return nil
 	}
-	dirEntries := V(os.ReadDir(cacheRootDirPath))
-	if err != nil {
-		return err
-	}
-	for _, dirEntry := range dirEntries {
-		if !dirEntry.IsDir() {
-			continue
-		}
-		statInfoFile := V(os.Stat(filepath.Join(cacheRootDirPath, dirEntry.Name(), common.InfoFileBase)))
-		if statInfoFile.IsDir() {
-			continue
-		}
-		if statInfoFile.ModTime().After(time.Now().Add(-cleanupThresholdDays * 24 * time.Hour)) {
-			continue
-		}
-		V0(os.RemoveAll(filepath.Join(cacheRootDirPath, dirEntry.Name())))
+	entries := V(common.CacheEntries(cacheRootDirPath))
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].LastUsed.Before(entries[j].LastUsed)
+	})
+	for _, entry := range entriesToPrune(entries, pruneOptionsT{
+		olderThan: time.Duration(options.thresholdDays) * 24 * time.Hour,
+		maxSize:   options.maxSize,
+	}, time.Now()) {
+		V0(os.RemoveAll(entry.DirPath))
 	}
 	return nil
 }
@@ -137,7 +119,12 @@ func cleanupOldBinaries(
 func recreateLinks() (err error) {
 	defer Catch(&err)
 	// Clean up old binaries.
-	V0(cleanupOldBinaries(V(common.CacheRootDirPath())))
+	V0(cleanupOldBinaries(
+		V(common.CacheRootDirPath()),
+		withCleanupConfig(V(common.GetConfig()).Cleanup),
+	))
+	// Rebuild the discovery index entirely, which also picks up the changes the stamps cannot tell, such as newly installed toolchains.
+	V(updatedIndex(bincDirPaths(), true))
 	linksDirPath := V(common.LinksDirPath())
 	// Remove all symlinks in the “links” directory.
 	for _, dirEntry := range V(os.ReadDir(linksDirPath)) {
@@ -150,50 +137,95 @@ func recreateLinks() (err error) {
 		}
 		V0(os.Remove(linkPath))
 	}
-	theMap := map[string]string{}
 	// Then create links.
-	return iterateOverManagers(
-		func(manager common.Manager) (err error) {
-			defer Catch(&err)
-			for _, commandBaseInfo := range manager.GetCommandBaseInfoList() {
-				linkPath := filepath.Join(linksDirPath, commandBaseInfo.CmdBase)
-				if _, err := os.Lstat(linkPath); err == nil {
-					println("Conflicting source:", commandBaseInfo.SourcePath)
-					println("Previous source that will be active:", theMap[commandBaseInfo.CmdBase])
-					continue
-				}
-				theMap[commandBaseInfo.CmdBase] = commandBaseInfo.SourcePath
-				if err != nil && !os.IsNotExist(err) {
-					return err
-				}
-				V0(os.Symlink(copiedBase, linkPath))
-			}
-			return nil
-		},
-		nil,
-	)
+	names := map[string]bool{}
+	for _, resolution := range V(resolveAll()) {
+		names[resolution.Name] = true
+		V0(os.Symlink(copiedBase, filepath.Join(linksDirPath, resolution.Name)))
+		for _, shadowed := range resolution.Shadowed {
+			_, _ = fmt.Fprintf(os.Stderr, "Shadowed: %s (%s) by %s (%s)\n",
+				shadowed.SourcePath,
+				shadowed.Factory.Name,
+				resolution.Winner.SourcePath,
+				resolution.Winner.Factory.Name,
+			)
+		}
+	}
+	// Aliases do not override commands.
+	for alias, name := range aliases() {
+		if names[alias] || !names[name] {
+			continue
+		}
+		V0(os.Symlink(copiedBase, filepath.Join(linksDirPath, alias)))
+	}
+	return nil
+}
+
+// addResolutionDependencies makes the stamp depend on what can change the resolution of the command:
+// the directories searched, which change when commands are added, and the configuration files.
+func addResolutionDependencies(stamp *common.LaunchStamp) {
+	stamp.AddEnv("BINCPATH", "XDG_CONFIG_HOME")
+	stamp.AddFiles(common.ConfigFilePath())
+	for _, dirPath := range bincDirPaths() {
+		stamp.AddFiles(dirPath, filepath.Join(dirPath, common.DirConfigBase))
+	}
+}
+
+// runStamp runs the command line recorded in the stamp with the arguments. The cache entry is marked as used,
+// as the manager which would do so is skipped.
+func runStamp(stamp *common.LaunchStamp, args []string) error {
+	Ignore(common.TouchLastUsed(filepath.Dir(stamp.CachedPath)))
+	cmd := exec.Command(stamp.Command[0], append(slices.Clone(stamp.Command[1:]), args...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return common.RunCommand(cmd)
+}
+
+// runCommand runs the command with its manager. With the fast path enabled, the stamp recorded at the previous launch is used
+// while it is valid, and otherwise a new one is recorded if the manager supports it.
+func runCommand(args []string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	name := filepath.Base(args[0])
+	fastPath := V(common.GetConfig()).FastPath
+	if fastPath && !shouldRebuild {
+		if stamp, err := common.LoadLaunchStamp(name); err == nil && stamp.IsValid() {
+			return runStamp(stamp, args[1:])
+		}
+	}
+	resolution := V(resolveCommandOrAlias(name))
+	if resolution.Name != name {
+		args = append([]string{resolution.Name}, args[1:]...)
+	}
+	if fastLauncher, ok := resolution.Winner.Manager.(common.FastLauncher); ok && fastPath {
+		stamp, err := fastLauncher.LaunchStamp(resolution.Name, shouldRebuild)
+		if err == nil {
+			addResolutionDependencies(stamp)
+			// The stamp is only a shortcut, so failing to record it is not fatal.
+			Ignore(common.SaveLaunchStamp(name, stamp))
+			return runStamp(stamp, args[1:])
+		}
+		if !errors.Is(err, common.ErrNoLaunchStamp) {
+			return err
+		}
+	}
+	return resolution.Winner.Manager.Run(args, shouldRebuild)
 }
 
 func execute(args []string, shouldRebuild bool) (err error) {
-	return iterateOverManagers(
-		func(manager common.Manager) (err error) {
-			defer Catch(&err)
-			if !manager.CanRun(filepath.Base(args[0])) {
-				return nil
-			}
-			err = manager.Run(args, shouldRebuild)
-			if err != nil {
-				var exitError *exec.ExitError
-				if errors.As(err, &exitError) {
-					os.Exit(exitError.ExitCode())
-				}
-				return err
-			}
-			os.Exit(0)
-			return nil // unreachable
-		},
-		errors.New(fmt.Sprintf("no matching command found: %s", args[0])),
-	)
+	defer Catch(&err)
+	// Once the command is ready, it replaces this process.
+	common.SetExecEnabled(true)
+	err = runCommand(args, shouldRebuild)
+	if err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			common.ExitAs(exitError)
+		}
+		return err
+	}
+	os.Exit(0)
+	return nil // unreachable
 }
 
 // install installs the given binary to the “links” directory.
@@ -253,6 +285,16 @@ func Main(args []string) (err error) {
 		return recreateLinks()
 	case "which":
 		return which(args[2])
+	case "list", "ls":
+		return list(args[2:], os.Stdout)
+	case "conflicts":
+		return conflicts(args[2:], os.Stdout)
+	case "build", "prebuild":
+		return build(args[2:], shouldRebuild, os.Stdout)
+	case "cache":
+		return cacheCommand(args[2:], os.Stdout)
+	case "config":
+		return configCommand(args[2:], os.Stdout)
 	}
 	return errors.New(fmt.Sprintf("unknown command: %s", args[1]))
 }
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"github.com/knaka/binc/lib/common"
 	"github.com/knaka/binc/lib/mock"
 	testfsutils "github.com/knaka/go-testutils/fs"
 	. "github.com/knaka/go-utils"
@@ -8,6 +9,10 @@ import (
 	"go.uber.org/mock/gomock"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -52,3 +57,133 @@ func TestCleanupOldBinaries(t *testing.T) {
 	assert.Len(t, dirEntries, 1)
 	assert.Equal(t, "9b19d37", dirEntries[0].Name())
 }
+
+// An entry built long ago but used recently should be kept.
+func TestCleanupOldBinariesLastUsed(t *testing.T) {
+	cacheRootDirPath := filepath.Join(t.TempDir(), "cache")
+	V0(testfsutils.CopyDir(
+		cacheRootDirPath,
+		filepath.Join("testdata", "cache"),
+	))
+	for _, hashStr := range []string{"3f7e097", "9b19d37"} {
+		V0(os.Chtimes(
+			filepath.Join(cacheRootDirPath, hashStr, ".info.json"),
+			time.Time{},
+			time.Now().AddDate(0, 0, -cleanupThresholdDays-1),
+		))
+	}
+	V0(common.TouchLastUsed(filepath.Join(cacheRootDirPath, "9b19d37")))
+	V0(cleanupOldBinaries(cacheRootDirPath, withRandFn(AlwaysZero)))
+	dirEntries := V(os.ReadDir(cacheRootDirPath))
+	assert.Len(t, dirEntries, 1)
+	assert.Equal(t, "9b19d37", dirEntries[0].Name())
+}
+
+// The least recently used entry should be removed to fit in the budget of the total size.
+func TestCleanupOldBinariesMaxSize(t *testing.T) {
+	cacheRootDirPath := filepath.Join(t.TempDir(), "cache")
+	V0(testfsutils.CopyDir(
+		cacheRootDirPath,
+		filepath.Join("testdata", "cache"),
+	))
+	V0(common.TouchLastUsed(filepath.Join(cacheRootDirPath, "3f7e097")))
+	V0(os.Chtimes(
+		filepath.Join(cacheRootDirPath, "3f7e097", common.LastUsedFileBase),
+		time.Time{},
+		time.Now().Add(-time.Hour),
+	))
+	V0(common.TouchLastUsed(filepath.Join(cacheRootDirPath, "9b19d37")))
+	V0(cleanupOldBinaries(
+		cacheRootDirPath,
+		withRandFn(AlwaysZero),
+		withCleanupConfig(common.CleanupConfig{
+			Cycle:         cleanupCycle,
+			ThresholdDays: cleanupThresholdDays,
+			MaxSize:       "1M",
+		}),
+	))
+	dirEntries := V(os.ReadDir(cacheRootDirPath))
+	assert.Len(t, dirEntries, 1)
+	assert.Equal(t, "9b19d37", dirEntries[0].Name())
+}
+
+// A launch with a stamp marks the cache entry as used, so that the cleanup does not remove it.
+func TestRunStampTouchesLastUsed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no true command")
+	}
+	cacheDirPath := t.TempDir()
+	lastUsedFilePath := filepath.Join(cacheDirPath, common.LastUsedFileBase)
+	V0(os.WriteFile(lastUsedFilePath, nil, 0644))
+	oldTime := time.Now().AddDate(0, 0, -cleanupThresholdDays-1)
+	V0(os.Chtimes(lastUsedFilePath, oldTime, oldTime))
+	stamp := &common.LaunchStamp{
+		Command:    []string{"true"},
+		CachedPath: filepath.Join(cacheDirPath, "main"),
+	}
+	V0(runStamp(stamp, nil))
+	assert.True(t, V(os.Stat(lastUsedFilePath)).ModTime().After(oldTime.Add(time.Hour)))
+}
+
+// noStampManagerT runs the commands of the files with the extension “.nostamp”, none of which can be launched with a stamp.
+type noStampManagerT struct {
+	filePaths []string
+	ran       []string
+}
+
+func (m *noStampManagerT) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
+	for _, filePath := range m.filePaths {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    strings.TrimSuffix(filepath.Base(filePath), noStampExt),
+			SourcePath: filePath,
+		})
+	}
+	return infoList
+}
+
+func (m *noStampManagerT) CanRun(cmdBase string) bool {
+	return slices.ContainsFunc(m.filePaths, func(filePath string) bool { return filepath.Base(filePath) == cmdBase+noStampExt })
+}
+
+func (m *noStampManagerT) Run(args []string, _ bool) error {
+	m.ran = append(m.ran, filepath.Base(args[0]))
+	return nil
+}
+
+func (m *noStampManagerT) LaunchStamp(_ string, _ bool) (*common.LaunchStamp, error) {
+	return nil, common.ErrNoLaunchStamp
+}
+
+const noStampExt = ".nostamp"
+
+var noStampManagers = map[string]*noStampManagerT{}
+
+var registerNoStampManager = sync.OnceFunc(func() {
+	common.RegisterManagerFactory("No Stamp Manager", func(dirPath string) common.Manager {
+		filePaths := V(filepath.Glob(filepath.Join(dirPath, "*"+noStampExt)))
+		if len(filePaths) == 0 {
+			return nil
+		}
+		manager := &noStampManagerT{filePaths: filePaths}
+		noStampManagers[dirPath] = manager
+		return manager
+	}, 50)
+})
+
+// A command whose manager declines the stamp is run by the manager even with the fast path enabled, and no stamp is recorded.
+func TestRunCommandNoLaunchStamp(t *testing.T) {
+	registerNoStampManager()
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	common.ResetConfig()
+	defer common.ResetConfig()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	V0(os.MkdirAll(common.ConfigDirPath(), 0755))
+	V0(os.WriteFile(common.ConfigFilePath(), []byte("fast_path = true\n"), 0644))
+	dirPath := t.TempDir()
+	V0(os.WriteFile(filepath.Join(dirPath, "hello"+noStampExt), nil, 0644))
+	t.Setenv("BINCPATH", dirPath)
+	V0(runCommand([]string{"hello", "world"}, false))
+	assert.Equal(t, []string{"hello"}, noStampManagers[dirPath].ran)
+	_, err := common.LoadLaunchStamp("hello")
+	assert.Error(t, err)
+}
@@ -0,0 +1,245 @@
+package nim
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/samber/lo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const nimExt = ".nim"
+
+var reImport = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`^\s*(?:import|include)\s+(.+)$`)
+})
+
+var reFromImport = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`^\s*from\s+(\S+)\s+import\b`)
+})
+
+// importedModules returns the names of the modules in an import statement such as “import std/os, ./util as u, helpers”.
+func importedModules(line string) (modules []string) {
+	if match := reFromImport().FindStringSubmatch(line); match != nil {
+		return []string{match[1]}
+	}
+	match := reImport().FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	statement, _, _ := strings.Cut(match[1], "#")
+	// Grouped imports such as “std/[os, strutils]” are of the standard library or packages.
+	if strings.Contains(statement, "[") {
+		return nil
+	}
+	for _, module := range strings.Split(statement, ",") {
+		module, _, _ = strings.Cut(strings.TrimSpace(module), " as ")
+		module = strings.Trim(strings.TrimSpace(module), `"`)
+		if module != "" {
+			modules = append(modules, module)
+		}
+	}
+	return modules
+}
+
+// localImports returns the source file and the local modules it imports or includes transitively.
+func localImports(nimFilePath string) (filePaths []string, err error) {
+	defer Catch(&err)
+	visited := map[string]bool{}
+	queue := []string{nimFilePath}
+	for len(queue) > 0 {
+		filePath := queue[0]
+		queue = queue[1:]
+		if visited[filePath] {
+			continue
+		}
+		visited[filePath] = true
+		filePaths = append(filePaths, filePath)
+		(func() {
+			in := V(os.Open(filePath))
+			defer (func() { Ignore(in.Close()) })()
+			scanner := bufio.NewScanner(in)
+			for scanner.Scan() {
+				for _, module := range importedModules(scanner.Text()) {
+					importedPath := filepath.Join(filepath.Dir(filePath), strings.TrimSuffix(module, nimExt)+nimExt)
+					if _, err := os.Stat(importedPath); err == nil {
+						queue = append(queue, importedPath)
+					}
+				}
+			}
+			V0(scanner.Err())
+		})()
+	}
+	return filePaths, nil
+}
+
+// exeBuildInfo returns the build information of the source file and the path of the cached executable for it.
+func exeBuildInfo(nimFilePath string, cmdBase string) (buildInfo *common.BuildInfo, exePath string, err error) {
+	defer Catch(&err)
+	var fileInfoList []*common.FileInfo
+	for _, filePath := range V(localImports(nimFilePath)) {
+		fileInfoList = append(fileInfoList, V(common.GetFileInfo(filePath)))
+	}
+	// The configuration files next to the source affect the build as well.
+	for _, configFilePath := range []string{
+		filepath.Join(filepath.Dir(nimFilePath), "nim.cfg"),
+		filepath.Join(filepath.Dir(nimFilePath), "config.nims"),
+		strings.TrimSuffix(nimFilePath, nimExt) + ".nims",
+		strings.TrimSuffix(nimFilePath, nimExt) + ".nim.cfg",
+	} {
+		if _, err := os.Stat(configFilePath); err == nil {
+			fileInfoList = append(fileInfoList, V(common.GetFileInfo(configFilePath)))
+		}
+	}
+	buildInfo = common.NewBuildInfo(
+		V(nimVersion()),
+		common.BuildFlags("nim", filepath.Dir(nimFilePath)),
+		fileInfoList,
+	)
+	exePath = V(common.CachedExePath(buildInfo.Hash, cmdBase))
+	return buildInfo, exePath, nil
+}
+
+func ensureExeFile(nimFilePath string, cmdBase string, shouldRebuild bool) (buildInfo *common.BuildInfo, exePath string, err error) {
+	defer Catch(&err)
+	buildInfo, exePath, err = exeBuildInfo(nimFilePath, cmdBase)
+	if err != nil {
+		return nil, "", err
+	}
+	V0(common.EnsureBuilt(buildInfo, exePath, shouldRebuild, func(tempPath string) error {
+		// Keep the generated C sources out of the cache entry.
+		nimCacheDirPath := tempPath + "-nimcache"
+		defer (func() { Ignore(os.RemoveAll(nimCacheDirPath)) })()
+		args := []string{"c", "--hints:off"}
+		args = append(args, buildInfo.Args...)
+		args = append(args,
+			"--nimcache:"+nimCacheDirPath,
+			"--outdir:"+filepath.Dir(tempPath),
+			"--out:"+filepath.Base(tempPath),
+			nimFilePath,
+		)
+		cmd := exec.Command(V(nimCommand()), args...)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}))
+	return buildInfo, exePath, nil
+}
+
+// --------
+
+type NimFileManager struct {
+	nimFilePaths []string
+}
+
+var _ common.Manager = &NimFileManager{}
+var _ common.CacheChecker = &NimFileManager{}
+var _ common.Builder = &NimFileManager{}
+var _ common.FastLauncher = &NimFileManager{}
+
+func (m *NimFileManager) findSource(cmdBase string) (nimFilePath string, err error) {
+	for _, nimFilePath := range m.nimFilePaths {
+		if filepath.Base(nimFilePath) == cmdBase+nimExt {
+			return nimFilePath, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("no matching nim file found: %s", cmdBase))
+}
+
+func (m *NimFileManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
+	for _, nimFilePath := range m.nimFilePaths {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    strings.TrimSuffix(filepath.Base(nimFilePath), nimExt),
+			SourcePath: nimFilePath,
+		})
+	}
+	return infoList
+}
+
+func (m *NimFileManager) CanRun(cmdBase string) bool {
+	_, err := m.findSource(cmdBase)
+	return err == nil
+}
+
+func (m *NimFileManager) Run(args []string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	cmdBase := filepath.Base(args[0])
+	_, exePath, err := ensureExeFile(V(m.findSource(cmdBase)), cmdBase, shouldRebuild)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exePath, args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return common.RunCommand(cmd)
+}
+
+func (m *NimFileManager) Build(cmdBase string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	_, _, err = ensureExeFile(V(m.findSource(cmdBase)), cmdBase, shouldRebuild)
+	return err
+}
+
+func (m *NimFileManager) CachedPath(cmdBase string) (cachedPath string, err error) {
+	defer Catch(&err)
+	_, cachedPath, err = exeBuildInfo(V(m.findSource(cmdBase)), cmdBase)
+	return cachedPath, err
+}
+
+func (m *NimFileManager) LaunchStamp(cmdBase string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
+	defer Catch(&err)
+	buildInfo, exePath, err := ensureExeFile(V(m.findSource(cmdBase)), cmdBase, shouldRebuild)
+	if err != nil {
+		return nil, err
+	}
+	return common.NewLaunchStamp([]string{exePath}, exePath, buildInfo, nil, V(nimCommand())), nil
+}
+
+var nimCommand = sync.OnceValues(func() (nimPath string, err error) {
+	defer Catch(&err)
+	if path := common.ToolPath("nim"); path != "" {
+		return path, nil
+	}
+	return V(exec.LookPath("nim")), nil
+})
+
+// nimVersion returns the first line of the version output of the compiler, such as “Nim Compiler Version 2.0.8 [Linux: amd64]”.
+var nimVersion = sync.OnceValues(func() (version string, err error) {
+	defer Catch(&err)
+	output := string(V(exec.Command(V(nimCommand()), "--version").Output()))
+	version, _, _ = strings.Cut(output, "\n")
+	return strings.TrimSpace(version), nil
+})
+
+func newNimFileManager(dirPath string) common.Manager {
+	if _, err := nimCommand(); err != nil {
+		return nil
+	}
+	nimFilePaths := V(filepath.Glob(filepath.Join(dirPath, "*"+nimExt)))
+	nimFilePaths = lo.Filter(nimFilePaths, func(nimFilePath string, _ int) bool {
+		return !strings.HasPrefix(filepath.Base(nimFilePath), "_") &&
+			!strings.HasPrefix(filepath.Base(nimFilePath), ".")
+	})
+	if len(nimFilePaths) == 0 {
+		return nil
+	}
+	return &NimFileManager{
+		nimFilePaths: nimFilePaths,
+	}
+}
+
+func init() {
+	common.RegisterManagerFactory(
+		"Nim File Manager",
+		newNimFileManager,
+		50,
+	)
+}
@@ -0,0 +1,77 @@
+package nim
+
+import (
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalImports(t *testing.T) {
+	dirPath := t.TempDir()
+	mainFilePath := filepath.Join(dirPath, "main.nim")
+	V0(os.WriteFile(mainFilePath, []byte(`import std/[os, strutils]
+import ./util as u, strformat
+from helpers import greet
+include "inc"
+
+echo greet(u.name())
+`), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "util.nim"), []byte("import helpers\nproc name*(): string = \"nim\"\n"), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "helpers.nim"), []byte("proc greet*(s: string): string = \"Hello, \" & s\n"), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "inc.nim"), []byte("discard\n"), 0644))
+	assert.ElementsMatch(t, []string{
+		mainFilePath,
+		filepath.Join(dirPath, "util.nim"),
+		filepath.Join(dirPath, "helpers.nim"),
+		filepath.Join(dirPath, "inc.nim"),
+	}, V(localImports(mainFilePath)))
+}
+
+// fakeNim reports its version and “compiles” a source into a script which prints the path of the source.
+const fakeNim = `#!/bin/sh
+if [ "$1" = --version ]; then
+  echo "Nim Compiler Version 0.0.0 [Linux: amd64]"
+  echo "fake"
+  exit 0
+fi
+for arg in "$@"; do
+  case "$arg" in
+  --outdir:*) outdir="${arg#--outdir:}" ;;
+  --out:*) out="${arg#--out:}" ;;
+  *.nim) src="$arg" ;;
+  esac
+done
+printf '#!/bin/sh\necho %s\n' "$src" > "$outdir/$out"
+chmod +x "$outdir/$out"
+`
+
+// A source is compiled into the cache, and editing a module it imports or the configuration changes the cache entry.
+func TestEnsureExeFile(t *testing.T) {
+	common.InstallFakeTool(t, "nim", fakeNim)
+	dirPath := t.TempDir()
+	mainFilePath := filepath.Join(dirPath, "hello.nim")
+	V0(os.WriteFile(mainFilePath, []byte("import ./util\necho name()\n"), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "util.nim"), []byte("proc name*(): string = \"nim\"\n"), 0644))
+
+	buildInfo, exePath, err := ensureExeFile(mainFilePath, "hello", false)
+	V0(err)
+	assert.Equal(t, "Nim Compiler Version 0.0.0 [Linux: amd64]", V(nimVersion()))
+	assert.Equal(t, mainFilePath+"\n", string(V(exec.Command(exePath).Output())))
+	assert.Empty(t, V(filepath.Glob(filepath.Join(filepath.Dir(exePath), "*-nimcache"))))
+
+	V0(os.WriteFile(filepath.Join(dirPath, "util.nim"), []byte("proc name*(): string = \"Nim\"\n"), 0644))
+	otherBuildInfo, otherExePath, err := ensureExeFile(mainFilePath, "hello", false)
+	V0(err)
+	assert.NotEqual(t, buildInfo.HashStr, otherBuildInfo.HashStr)
+	assert.NotEqual(t, exePath, otherExePath)
+	assert.FileExists(t, otherExePath)
+
+	V0(os.WriteFile(filepath.Join(dirPath, "nim.cfg"), []byte("-d:release\n"), 0644))
+	configuredBuildInfo, _, err := ensureExeFile(mainFilePath, "hello", false)
+	V0(err)
+	assert.NotEqual(t, otherBuildInfo.HashStr, configuredBuildInfo.HashStr)
+}
@@ -0,0 +1,112 @@
+package node
+
+import (
+	. "github.com/knaka/go-utils"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Files next to “package.json” which affect the bundle.
+var projectFileBases = []string{
+	"package.json",
+	"package-lock.json",
+	"npm-shrinkwrap.json",
+	"yarn.lock",
+	"pnpm-lock.yaml",
+	"bun.lock",
+	"bun.lockb",
+	"deno.json",
+	"deno.lock",
+	"tsconfig.json",
+}
+
+// Extensions tried for an import specifier without one, in the order of the resolution of the bundlers.
+var resolvedExtensions = []string{
+	".ts",
+	".tsx",
+	".mts",
+	".js",
+	".mjs",
+	".jsx",
+}
+
+// reRelativeSpecifier matches the relative specifiers of import and export statements, dynamic imports and requires.
+var reRelativeSpecifier = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?:\bfrom\s*|\bimport\s*\(?\s*|\brequire\s*\(\s*)["'](\.{1,2}/[^"']+)["']`)
+})
+
+// resolveRelative resolves the relative specifier to a file as the bundlers do, or returns an empty string if it is not found.
+func resolveRelative(dirPath string, specifier string) string {
+	basePath := filepath.Join(dirPath, specifier)
+	candidates := []string{basePath}
+	// A TypeScript source may import another one with the “.js” extension of its output.
+	if ext := filepath.Ext(basePath); ext == ".js" || ext == ".mjs" {
+		candidates = append(candidates, strings.TrimSuffix(basePath, ext)+strings.Replace(ext, "js", "ts", 1))
+	}
+	for _, ext := range resolvedExtensions {
+		candidates = append(candidates, basePath+ext)
+	}
+	for _, ext := range resolvedExtensions {
+		candidates = append(candidates, filepath.Join(basePath, "index"+ext))
+	}
+	for _, candidate := range candidates {
+		if stat, err := os.Stat(candidate); err == nil && !stat.IsDir() {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// localImports returns the script and the local modules it imports transitively. The packages are tracked by the lockfile instead.
+func localImports(scriptPath string) (filePaths []string, err error) {
+	defer Catch(&err)
+	visited := map[string]bool{}
+	queue := []string{scriptPath}
+	for len(queue) > 0 {
+		filePath := queue[0]
+		queue = queue[1:]
+		if visited[filePath] {
+			continue
+		}
+		visited[filePath] = true
+		filePaths = append(filePaths, filePath)
+		for _, match := range reRelativeSpecifier().FindAllStringSubmatch(string(V(os.ReadFile(filePath))), -1) {
+			if importedPath := resolveRelative(filepath.Dir(filePath), match[1]); importedPath != "" {
+				queue = append(queue, importedPath)
+			}
+		}
+	}
+	return filePaths, nil
+}
+
+// findProjectDir returns the nearest directory with “package.json” or “deno.json” above the script, or an empty string if there is none.
+func findProjectDir(scriptPath string) string {
+	dirPathPrev := ""
+	for dirPath := filepath.Dir(scriptPath); dirPath != dirPathPrev; dirPath = filepath.Dir(dirPath) {
+		for _, base := range []string{"package.json", "deno.json"} {
+			if _, err := os.Stat(filepath.Join(dirPath, base)); err == nil {
+				return dirPath
+			}
+		}
+		dirPathPrev = dirPath
+	}
+	return ""
+}
+
+// buildFilePaths returns the files which affect the bundle: the local modules, and the manifest, the lockfile and the configuration of the project.
+func buildFilePaths(scriptPath string) (filePaths []string, err error) {
+	defer Catch(&err)
+	filePaths = V(localImports(scriptPath))
+	if projectDirPath := findProjectDir(scriptPath); projectDirPath != "" {
+		for _, base := range projectFileBases {
+			filePath := filepath.Join(projectDirPath, base)
+			if _, err := os.Stat(filePath); err == nil {
+				filePaths = append(filePaths, filePath)
+			}
+		}
+	}
+	return filePaths, nil
+}
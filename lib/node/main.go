@@ -0,0 +1,292 @@
+package node
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/samber/lo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var extensions = []string{
+	".ts",
+	".mjs",
+}
+
+// Runtimes which can run the bundles, the first of which is the default.
+var runtimeNames = []string{
+	"node",
+	"deno",
+	"bun",
+}
+
+// lookupTool returns the path of the tool configured or found on $PATH.
+func lookupTool(name string) (toolPath string, err error) {
+	if path := common.ToolPath(name); path != "" {
+		return path, nil
+	}
+	return exec.LookPath(name)
+}
+
+var toolVersions sync.Map
+
+// toolVersion returns the first line of the version output of the tool such as “v20.19.5”.
+func toolVersion(toolPath string) (version string, err error) {
+	defer Catch(&err)
+	if version, ok := toolVersions.Load(toolPath); ok {
+		return version.(string), nil
+	}
+	output := string(V(exec.Command(toolPath, "--version").Output()))
+	version, _, _ = strings.Cut(output, "\n")
+	version = strings.TrimSpace(version)
+	toolVersions.Store(toolPath, version)
+	return version, nil
+}
+
+// shebangRuntime returns the runtime named in the shebang of the script such as “#!/usr/bin/env -S deno run -A”, or an empty string.
+func shebangRuntime(scriptPath string) (runtimeName string, err error) {
+	defer Catch(&err)
+	in := V(os.Open(scriptPath))
+	defer (func() { Ignore(in.Close()) })()
+	scanner := bufio.NewScanner(in)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "#!") {
+		return "", scanner.Err()
+	}
+	for _, field := range strings.Fields(scanner.Text()[2:]) {
+		switch filepath.Base(field) {
+		case "node", "tsx", "ts-node":
+			return "node", nil
+		case "deno":
+			return "deno", nil
+		case "bun", "bunx":
+			return "bun", nil
+		}
+	}
+	return "", nil
+}
+
+// runtimeName returns the runtime of the script: the one in its shebang, the one configured for the directory or globally, or the default.
+func runtimeName(scriptPath string) (name string, err error) {
+	defer Catch(&err)
+	if name := V(shebangRuntime(scriptPath)); name != "" {
+		return name, nil
+	}
+	if dirConfig, err := common.GetDirConfig(filepath.Dir(scriptPath)); err == nil && dirConfig.JsRuntime != "" {
+		name = dirConfig.JsRuntime
+	} else if config, err := common.GetConfig(); err == nil && config.JsRuntime != "" {
+		name = config.JsRuntime
+	} else {
+		return runtimeNames[0], nil
+	}
+	if !slices.Contains(runtimeNames, name) {
+		return "", errors.New(fmt.Sprintf("unknown JavaScript runtime: %s", name))
+	}
+	return name, nil
+}
+
+// bundlerT is the tool which bundles the script and its dependencies into a single file.
+type bundlerT struct {
+	name string
+	path string
+}
+
+// findBundler returns esbuild of the project, the configured or installed one, or bun as a fallback.
+func findBundler(scriptPath string) (bundler *bundlerT, err error) {
+	if projectDirPath := findProjectDir(scriptPath); projectDirPath != "" {
+		esbuildPath := filepath.Join(projectDirPath, "node_modules", ".bin", "esbuild")
+		if _, err := os.Stat(esbuildPath); err == nil {
+			return &bundlerT{"esbuild", esbuildPath}, nil
+		}
+	}
+	if esbuildPath, err := lookupTool("esbuild"); err == nil {
+		return &bundlerT{"esbuild", esbuildPath}, nil
+	}
+	if bunPath, err := lookupTool("bun"); err == nil {
+		return &bundlerT{"bun", bunPath}, nil
+	}
+	return nil, errors.New("no bundler found; install esbuild or bun")
+}
+
+// bundleArgs returns the arguments of the bundler to bundle the script into an ES module for the runtime.
+func (b *bundlerT) bundleArgs(scriptPath string, runtimeName string, outPath string) []string {
+	if b.name == "bun" {
+		return []string{"build", scriptPath, "--target=" + Ternary(runtimeName == "bun", "bun", "node"), "--outfile", outPath}
+	}
+	return []string{
+		scriptPath,
+		"--bundle",
+		"--platform=node",
+		"--format=esm",
+		"--log-level=warning",
+		// The CommonJS packages in the bundle need `require` to load the built-in modules.
+		"--banner:js=import { createRequire as __bincCreateRequire } from 'node:module'; const require = __bincCreateRequire(import.meta.url);",
+		"--outfile=" + outPath,
+	}
+}
+
+// bundleT is how a script is bundled and run.
+type bundleT struct {
+	runtimeName string
+	runtimePath string
+	bundler     *bundlerT
+	// flags are the ones for the bundler in the configuration.
+	flags      []string
+	buildInfo  *common.BuildInfo
+	bundlePath string
+}
+
+// command returns the command line to run the bundle.
+func (b *bundleT) command() []string {
+	if b.runtimeName == "deno" {
+		return []string{b.runtimePath, "run", "--allow-all", b.bundlePath}
+	}
+	return []string{b.runtimePath, b.bundlePath}
+}
+
+// newBundle returns how the script is bundled, keyed on the sources, the files of the project, and the versions of the runtime and the bundler.
+func newBundle(scriptPath string, cmdBase string) (bundle *bundleT, err error) {
+	defer Catch(&err)
+	bundle = &bundleT{
+		runtimeName: V(runtimeName(scriptPath)),
+		bundler:     V(findBundler(scriptPath)),
+	}
+	bundle.runtimePath = V(lookupTool(bundle.runtimeName))
+	var fileInfoList []*common.FileInfo
+	for _, filePath := range V(buildFilePaths(scriptPath)) {
+		fileInfoList = append(fileInfoList, V(common.GetFileInfo(filePath)))
+	}
+	bundle.flags = common.BuildFlags("js", filepath.Dir(scriptPath))
+	bundle.buildInfo = common.NewBuildInfo(
+		bundle.runtimeName+" "+V(toolVersion(bundle.runtimePath)),
+		append([]string{bundle.bundler.name, V(toolVersion(bundle.bundler.path))}, bundle.flags...),
+		fileInfoList,
+	)
+	bundle.bundlePath = V(common.CachedExePath(bundle.buildInfo.Hash, cmdBase+".mjs"))
+	return bundle, nil
+}
+
+func ensureBundle(scriptPath string, cmdBase string, shouldRebuild bool) (bundle *bundleT, err error) {
+	defer Catch(&err)
+	bundle = V(newBundle(scriptPath, cmdBase))
+	V0(common.EnsureBuilt(bundle.buildInfo, bundle.bundlePath, shouldRebuild, func(tempPath string) error {
+		args := append(bundle.bundler.bundleArgs(scriptPath, bundle.runtimeName, tempPath), bundle.flags...)
+		cmd := exec.Command(bundle.bundler.path, args...)
+		cmd.Dir = filepath.Dir(scriptPath)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}))
+	return bundle, nil
+}
+
+// --------
+
+type ScriptManager struct {
+	scriptPaths []string
+}
+
+var _ common.Manager = &ScriptManager{}
+var _ common.CacheChecker = &ScriptManager{}
+var _ common.Builder = &ScriptManager{}
+var _ common.FastLauncher = &ScriptManager{}
+
+func cmdBaseOf(scriptPath string) string {
+	base := filepath.Base(scriptPath)
+	return base[:len(base)-len(filepath.Ext(base))]
+}
+
+func (m *ScriptManager) findScript(cmdBase string) (scriptPath string, err error) {
+	for _, scriptPath := range m.scriptPaths {
+		if cmdBaseOf(scriptPath) == cmdBase {
+			return scriptPath, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("no matching script found: %s", cmdBase))
+}
+
+func (m *ScriptManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
+	for _, scriptPath := range m.scriptPaths {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    cmdBaseOf(scriptPath),
+			SourcePath: scriptPath,
+		})
+	}
+	return infoList
+}
+
+func (m *ScriptManager) CanRun(cmdBase string) bool {
+	_, err := m.findScript(cmdBase)
+	return err == nil
+}
+
+func (m *ScriptManager) Run(args []string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	cmdBase := filepath.Base(args[0])
+	command := V(ensureBundle(V(m.findScript(cmdBase)), cmdBase, shouldRebuild)).command()
+	cmd := exec.Command(command[0], append(command[1:], args[1:]...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return common.RunCommand(cmd)
+}
+
+func (m *ScriptManager) Build(cmdBase string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	_ = V(ensureBundle(V(m.findScript(cmdBase)), cmdBase, shouldRebuild))
+	return nil
+}
+
+func (m *ScriptManager) CachedPath(cmdBase string) (cachedPath string, err error) {
+	defer Catch(&err)
+	return V(newBundle(V(m.findScript(cmdBase)), cmdBase)).bundlePath, nil
+}
+
+func (m *ScriptManager) LaunchStamp(cmdBase string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
+	defer Catch(&err)
+	bundle := V(ensureBundle(V(m.findScript(cmdBase)), cmdBase, shouldRebuild))
+	return common.NewLaunchStamp(
+		bundle.command(),
+		bundle.bundlePath,
+		bundle.buildInfo,
+		nil,
+		bundle.runtimePath,
+		bundle.bundler.path,
+	), nil
+}
+
+func newScriptManager(dirPath string) common.Manager {
+	if !lo.ContainsBy(runtimeNames, func(name string) bool { return E(lookupTool(name)) == nil }) {
+		return nil
+	}
+	var scriptPaths []string
+	for _, ext := range extensions {
+		scriptPaths = append(scriptPaths, V(filepath.Glob(filepath.Join(dirPath, "*"+ext)))...)
+	}
+	scriptPaths = lo.Filter(scriptPaths, func(scriptPath string, _ int) bool {
+		return !strings.HasPrefix(filepath.Base(scriptPath), "_") &&
+			!strings.HasPrefix(filepath.Base(scriptPath), ".") &&
+			// Declaration files are not scripts.
+			!strings.HasSuffix(scriptPath, ".d.ts")
+	})
+	if len(scriptPaths) == 0 {
+		return nil
+	}
+	return &ScriptManager{
+		scriptPaths: scriptPaths,
+	}
+}
+
+func init() {
+	common.RegisterManagerFactory(
+		"TypeScript/JavaScript Manager",
+		newScriptManager,
+		50,
+	)
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalImports(t *testing.T) {
+	dirPath := t.TempDir()
+	V0(os.MkdirAll(filepath.Join(dirPath, "lib"), 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, "package.json"), []byte("{}\n"), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "package-lock.json"), []byte("{}\n"), 0644))
+	scriptPath := filepath.Join(dirPath, "hello.ts")
+	V0(os.WriteFile(scriptPath, []byte(`#!/usr/bin/env -S deno run -A
+import { greet } from "./lib/greet.js";
+import chalk from "chalk";
+export * from './lib';
+console.log(greet("world"));
+`), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "lib", "greet.ts"), []byte(`export const greet = (s: string) => "Hello, " + s;
+`), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "lib", "index.ts"), []byte(`export { greet } from "./greet";
+`), 0644))
+	assert.Equal(t, []string{
+		scriptPath,
+		filepath.Join(dirPath, "lib", "greet.ts"),
+		filepath.Join(dirPath, "lib", "index.ts"),
+		filepath.Join(dirPath, "package.json"),
+		filepath.Join(dirPath, "package-lock.json"),
+	}, V(buildFilePaths(scriptPath)))
+	assert.Equal(t, "deno", V(shebangRuntime(scriptPath)))
+}
+
+// The script is bundled into the cache once and run with the runtime. The bundler is a fake which copies the script.
+func TestEnsureBundle(t *testing.T) {
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("no node")
+	}
+	homeDirPath := filepath.Join(t.TempDir(), "home")
+	common.SetHomeDirPath(homeDirPath)
+	common.ResetConfig()
+	defer common.ResetConfig()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	esbuildPath := filepath.Join(t.TempDir(), "esbuild")
+	V0(os.WriteFile(esbuildPath, []byte(`#!/bin/sh
+if [ "$1" = --version ]; then echo 0.0.0; exit 0; fi
+for arg in "$@"; do
+  case "$arg" in
+    --outfile=*) cp "$1" "${arg#--outfile=}" ;;
+  esac
+done
+`), 0755))
+	V0(os.MkdirAll(common.ConfigDirPath(), 0755))
+	V0(os.WriteFile(common.ConfigFilePath(), []byte(`
+[tools]
+esbuild = "`+esbuildPath+`"
+`), 0644))
+	scriptPath := filepath.Join(t.TempDir(), "hello.mjs")
+	V0(os.WriteFile(scriptPath, []byte("console.log('hello', process.argv[2]);\n"), 0644))
+	bundle := V(ensureBundle(scriptPath, "hello", false))
+	assert.Equal(t, "node", bundle.runtimeName)
+	command := bundle.command()
+	output := V(exec.Command(command[0], append(command[1:], "world")...).Output())
+	assert.Equal(t, "hello world\n", string(output))
+}
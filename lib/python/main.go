@@ -0,0 +1,288 @@
+package python
+
+import (
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/samber/lo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const pyExt = ".py"
+
+// mainFileBase is the base name of the file which is run for a package directory.
+const mainFileBase = "__main__.py"
+
+// Environment variables which affect the packages installed into a virtualenv.
+var installEnvNames = []string{
+	"PIP_INDEX_URL",
+	"PIP_EXTRA_INDEX_URL",
+	"UV_INDEX_URL",
+	"UV_EXTRA_INDEX_URL",
+}
+
+type PythonScriptManager struct {
+	pythonCmd string
+	// scriptPaths are the paths of the script files and the package directories.
+	scriptPaths []string
+}
+
+var _ common.Manager = &PythonScriptManager{}
+var _ common.CacheChecker = &PythonScriptManager{}
+var _ common.Builder = &PythonScriptManager{}
+
+func cmdBaseOf(scriptPath string) string {
+	return strings.TrimSuffix(filepath.Base(scriptPath), pyExt)
+}
+
+// mainFilePath returns the file which holds the inline metadata of the script or the package directory.
+func mainFilePath(scriptPath string) string {
+	if stat, err := os.Stat(scriptPath); err == nil && stat.IsDir() {
+		return filepath.Join(scriptPath, mainFileBase)
+	}
+	return scriptPath
+}
+
+var reMainGuard = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^if\s+__name__\s*==\s*["']__main__["']\s*:`)
+})
+
+// isScriptFile checks if the file is a script rather than a module imported by the others: it is executable,
+// or it has the inline metadata or the guard of the main module.
+func isScriptFile(filePath string) bool {
+	stat, err := os.Stat(filePath)
+	if err != nil || !stat.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS != "windows" && stat.Mode()&0111 != 0 {
+		return true
+	}
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return false
+	}
+	if reMainGuard().Match(source) {
+		return true
+	}
+	for _, match := range reMetadataBlock().FindAllSubmatch(source, -1) {
+		if string(match[reMetadataBlock().SubexpIndex("type")]) == "script" {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *PythonScriptManager) findScript(cmdBase string) (scriptPath string, err error) {
+	for _, scriptPath := range m.scriptPaths {
+		if cmdBaseOf(scriptPath) == cmdBase {
+			return scriptPath, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("no matching python script found: %s", cmdBase))
+}
+
+func (m *PythonScriptManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
+	for _, scriptPath := range m.scriptPaths {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    cmdBaseOf(scriptPath),
+			SourcePath: scriptPath,
+		})
+	}
+	return infoList
+}
+
+func (m *PythonScriptManager) CanRun(cmdBase string) bool {
+	_, err := m.findScript(cmdBase)
+	return err == nil
+}
+
+// venvPython returns the path of the interpreter in the virtualenv.
+func venvPython(venvPath string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(venvPath, "Scripts", "python.exe")
+	}
+	return filepath.Join(venvPath, "bin", "python")
+}
+
+// venvCompleteFileBase is the base name of the file created in the virtualenv once the dependencies are installed.
+const venvCompleteFileBase = ".binc-complete"
+
+// venvBuildInfo returns the build information of the virtualenv for the requirements of the script and its path in the cache.
+// The virtualenv does not depend on the script itself, so that the scripts with the same requirements share one.
+func venvBuildInfo(metadata *scriptMetadata) (buildInfo *common.BuildInfo, venvPath string, err error) {
+	defer Catch(&err)
+	var env []string
+	for _, name := range installEnvNames {
+		if value := os.Getenv(name); value != "" {
+			env = append(env, name+"="+value)
+		}
+	}
+	buildInfo = common.NewBuildInfo(
+		V(pythonVersion()),
+		metadata.Dependencies,
+		nil,
+		common.WithEnv(env),
+	)
+	venvPath = V(common.CachedExePath(buildInfo.Hash, "venv"))
+	return buildInfo, venvPath, nil
+}
+
+func runInstallCommand(env []string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// ensureVenv creates the virtualenv with the dependencies installed if it is not in the cache. uv is used if available as it is much faster than pip.
+func ensureVenv(metadata *scriptMetadata, shouldRebuild bool) (venvPath string, err error) {
+	defer Catch(&err)
+	buildInfo, venvPath, err := venvBuildInfo(metadata)
+	if err != nil {
+		return "", err
+	}
+	// The virtualenv is created at its final path under the lock, as the shebangs of the installed console scripts hold
+	// the absolute path of its interpreter. The file marking the completion is what is renamed into place instead.
+	V0(common.EnsureBuilt(buildInfo, filepath.Join(venvPath, venvCompleteFileBase), shouldRebuild, func(tempPath string) error {
+		// The old virtualenv is renamed aside at once, so that the other launchers wait for the lock instead of running in it
+		// while it is being removed, and it is removed once the new one is complete.
+		if _, err := os.Stat(venvPath); err == nil {
+			oldVenvPath := fmt.Sprintf("%s.old-%d", venvPath, os.Getpid())
+			V0(os.RemoveAll(oldVenvPath))
+			V0(os.Rename(venvPath, oldVenvPath))
+			defer (func() { Ignore(os.RemoveAll(oldVenvPath)) })()
+		}
+		pythonCmd := V(pythonCommand())
+		if uvCmd, err := uvCommand(); err == nil {
+			V0(runInstallCommand(buildInfo.Env, uvCmd, "venv", "--quiet", "--python", pythonCmd, venvPath))
+			V0(runInstallCommand(buildInfo.Env, uvCmd,
+				append([]string{"pip", "install", "--quiet", "--python", venvPython(venvPath)}, buildInfo.Args...)...))
+		} else {
+			V0(runInstallCommand(buildInfo.Env, pythonCmd, "-m", "venv", venvPath))
+			V0(runInstallCommand(buildInfo.Env, venvPython(venvPath),
+				append([]string{"-m", "pip", "install", "--quiet", "--disable-pip-version-check"}, buildInfo.Args...)...))
+		}
+		return os.WriteFile(tempPath, nil, 0644)
+	}))
+	return venvPath, nil
+}
+
+// interpreter returns the interpreter to run the script with, checking the required version and preparing the virtualenv for the dependencies.
+func (m *PythonScriptManager) interpreter(scriptPath string, shouldRebuild bool) (pythonCmd string, err error) {
+	defer Catch(&err)
+	metadata := V(readScriptMetadata(mainFilePath(scriptPath)))
+	if metadata.RequiresPython != "" {
+		version := V(pythonVersion())
+		if !V(versionSatisfies(version, metadata.RequiresPython)) {
+			return "", errors.New(fmt.Sprintf("%s requires Python %s, but %s is %s", scriptPath, metadata.RequiresPython, m.pythonCmd, version))
+		}
+	}
+	if len(metadata.Dependencies) == 0 {
+		return m.pythonCmd, nil
+	}
+	return venvPython(V(ensureVenv(metadata, shouldRebuild))), nil
+}
+
+func (m *PythonScriptManager) Run(args []string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	scriptPath := V(m.findScript(filepath.Base(args[0])))
+	// A package directory is run with its “__main__.py”.
+	cmd := exec.Command(V(m.interpreter(scriptPath, shouldRebuild)), append([]string{scriptPath}, args[1:]...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return common.RunCommand(cmd)
+}
+
+func (m *PythonScriptManager) Build(cmdBase string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	_ = V(m.interpreter(V(m.findScript(cmdBase)), shouldRebuild))
+	return nil
+}
+
+// CachedPath returns the path of the file marking the completion of the virtualenv for the script. The scripts without dependencies have none.
+func (m *PythonScriptManager) CachedPath(cmdBase string) (cachedPath string, err error) {
+	defer Catch(&err)
+	metadata := V(readScriptMetadata(mainFilePath(V(m.findScript(cmdBase)))))
+	if len(metadata.Dependencies) == 0 {
+		return "", errors.New(fmt.Sprintf("no virtualenv is needed: %s", cmdBase))
+	}
+	_, venvPath, err := venvBuildInfo(metadata)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(venvPath, venvCompleteFileBase), nil
+}
+
+var pythonCommand = sync.OnceValues(func() (pythonPath string, err error) {
+	defer Catch(&err)
+	if path := common.ToolPath("python"); path != "" {
+		return path, nil
+	}
+	if path, err := exec.LookPath("python3"); err == nil {
+		return path, nil
+	}
+	return V(exec.LookPath("python")), nil
+})
+
+var uvCommand = sync.OnceValues(func() (uvPath string, err error) {
+	defer Catch(&err)
+	if path := common.ToolPath("uv"); path != "" {
+		return path, nil
+	}
+	return V(exec.LookPath("uv")), nil
+})
+
+// pythonVersion returns the version of the interpreter such as “3.12.1”.
+var pythonVersion = sync.OnceValues(func() (version string, err error) {
+	defer Catch(&err)
+	output := V(exec.Command(V(pythonCommand()), "-c", "import platform; print(platform.python_version())").Output())
+	return strings.TrimSpace(string(output)), nil
+})
+
+func newPythonScriptManager(dirPath string) common.Manager {
+	pythonCmd, err := pythonCommand()
+	if err != nil {
+		return nil
+	}
+	scriptPaths := lo.Filter(V(filepath.Glob(filepath.Join(dirPath, "*"+pyExt))), func(scriptPath string, _ int) bool {
+		return isScriptFile(scriptPath)
+	})
+	for _, dirEntry := range V(os.ReadDir(dirPath)) {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dirPath, dirEntry.Name(), mainFileBase)); err == nil {
+			scriptPaths = append(scriptPaths, filepath.Join(dirPath, dirEntry.Name()))
+		}
+	}
+	scriptPaths = lo.Filter(scriptPaths, func(scriptPath string, _ int) bool {
+		return !strings.HasPrefix(filepath.Base(scriptPath), "_") &&
+			!strings.HasPrefix(filepath.Base(scriptPath), ".")
+	})
+	if len(scriptPaths) == 0 {
+		return nil
+	}
+	slices.Sort(scriptPaths)
+	return &PythonScriptManager{
+		pythonCmd:   pythonCmd,
+		scriptPaths: scriptPaths,
+	}
+}
+
+func init() {
+	common.RegisterManagerFactory(
+		"Python Script Manager",
+		newPythonScriptManager,
+		50,
+	)
+}
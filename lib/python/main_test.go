@@ -0,0 +1,79 @@
+package python
+
+import (
+	"archive/zip"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// writeWheel writes a wheel of the package “greet” with the console script “greet”, which is installed without the network.
+func writeWheel(dirPath string) (wheelPath string) {
+	wheelPath = filepath.Join(dirPath, "greet-0.1.0-py3-none-any.whl")
+	out := V(os.Create(wheelPath))
+	defer (func() { V0(out.Close()) })()
+	writer := zip.NewWriter(out)
+	for name, content := range map[string]string{
+		"greet/__init__.py":                      "def main():\n    print('Hello')\n",
+		"greet-0.1.0.dist-info/METADATA":         "Metadata-Version: 2.1\nName: greet\nVersion: 0.1.0\n",
+		"greet-0.1.0.dist-info/WHEEL":            "Wheel-Version: 1.0\nGenerator: binc\nRoot-Is-Purelib: true\nTag: py3-none-any\n",
+		"greet-0.1.0.dist-info/entry_points.txt": "[console_scripts]\ngreet = greet:main\n",
+		"greet-0.1.0.dist-info/RECORD":           "greet/__init__.py,,\ngreet-0.1.0.dist-info/METADATA,,\ngreet-0.1.0.dist-info/WHEEL,,\ngreet-0.1.0.dist-info/entry_points.txt,,\ngreet-0.1.0.dist-info/RECORD,,\n",
+	} {
+		V0(V(writer.Create(name)).Write([]byte(content)))
+	}
+	V0(writer.Close())
+	return wheelPath
+}
+
+// The console scripts installed into the virtualenv in the cache work, as the virtualenv is not moved after it is created.
+func TestEnsureVenv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no shebangs")
+	}
+	if _, err := pythonCommand(); err != nil {
+		t.Skip("no python")
+	}
+	if err := exec.Command(V(pythonCommand()), "-m", "pip", "--version").Run(); err != nil {
+		t.Skip("no pip")
+	}
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	metadata := &scriptMetadata{
+		Dependencies: []string{"greet @ file://" + filepath.ToSlash(writeWheel(t.TempDir()))},
+	}
+	venvPath := V(ensureVenv(metadata, false))
+	assert.FileExists(t, filepath.Join(venvPath, venvCompleteFileBase))
+	output := V(exec.Command(filepath.Join(venvPath, "bin", "greet")).Output())
+	assert.Equal(t, "Hello\n", string(output))
+}
+
+// Only the scripts are commands, not the modules they import, while the packages with “__main__.py” are as well.
+func TestNewPythonScriptManager(t *testing.T) {
+	if _, err := pythonCommand(); err != nil {
+		t.Skip("no python")
+	}
+	dirPath := t.TempDir()
+	V0(os.WriteFile(filepath.Join(dirPath, "guarded.py"), []byte("def main():\n    pass\n\nif __name__ == \"__main__\":\n    main()\n"), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "inline.py"), []byte("# /// script\n# dependencies = []\n# ///\nprint('hello')\n"), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "helpers.py"), []byte("def greet():\n    return 'hello'\n"), 0644))
+	V0(os.MkdirAll(filepath.Join(dirPath, "app"), 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, "app", mainFileBase), []byte("print('app')\n"), 0644))
+	expected := []string{"app", "guarded", "inline"}
+	if runtime.GOOS != "windows" {
+		V0(os.WriteFile(filepath.Join(dirPath, "plain.py"), []byte("print('plain')\n"), 0755))
+		expected = append(expected, "plain")
+	}
+	manager := newPythonScriptManager(dirPath)
+	assert.NotNil(t, manager)
+	var cmdBases []string
+	for _, info := range manager.GetCommandBaseInfoList() {
+		cmdBases = append(cmdBases, info.CmdBase)
+	}
+	assert.ElementsMatch(t, expected, cmdBases)
+	assert.False(t, manager.CanRun("helpers"))
+}
@@ -0,0 +1,151 @@
+package python
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	. "github.com/knaka/go-utils"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// scriptMetadata is the inline script metadata of PEP 723.
+type scriptMetadata struct {
+	Dependencies   []string `toml:"dependencies"`
+	RequiresPython string   `toml:"requires-python"`
+}
+
+// The regular expression of the reference implementation of PEP 723.
+var reMetadataBlock = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^# /// (?P<type>[a-zA-Z0-9-]+)$\s(?P<content>(^#(| .*)$\s)+)^# ///$`)
+})
+
+// readScriptMetadata reads the “script” block of the inline metadata in the file. A file without the block has empty metadata.
+func readScriptMetadata(filePath string) (metadata *scriptMetadata, err error) {
+	defer Catch(&err)
+	metadata = &scriptMetadata{}
+	source := string(V(os.ReadFile(filePath)))
+	var blocks []string
+	for _, match := range reMetadataBlock().FindAllStringSubmatch(source, -1) {
+		if match[reMetadataBlock().SubexpIndex("type")] == "script" {
+			blocks = append(blocks, match[reMetadataBlock().SubexpIndex("content")])
+		}
+	}
+	if len(blocks) == 0 {
+		return metadata, nil
+	}
+	if len(blocks) > 1 {
+		return nil, errors.New(fmt.Sprintf("multiple script blocks found: %s", filePath))
+	}
+	var content strings.Builder
+	for _, line := range strings.SplitAfter(blocks[0], "\n") {
+		if strings.HasPrefix(line, "# ") {
+			line = line[2:]
+		} else {
+			line = strings.TrimPrefix(line, "#")
+		}
+		content.WriteString(line)
+	}
+	V(toml.Decode(content.String(), metadata))
+	return metadata, nil
+}
+
+// parseVersion parses a release version such as “3.12.1” into its numbers. Pre-release and other suffixes are ignored.
+func parseVersion(s string) (numbers []int, err error) {
+	for _, part := range strings.Split(strings.TrimSpace(s), ".") {
+		digits := part
+		if i := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+			digits = digits[:i]
+		}
+		number, err := strconv.Atoi(digits)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid version: %s", s))
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+// compareVersions compares the versions, padding the shorter one with zeros.
+func compareVersions(a, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// hasPrefix checks if the version starts with the numbers of the prefix, for the wildcard such as “==3.12.*”.
+func hasPrefix(version, prefix []int) bool {
+	for i, number := range prefix {
+		if i >= len(version) {
+			if number != 0 {
+				return false
+			}
+		} else if version[i] != number {
+			return false
+		}
+	}
+	return true
+}
+
+// versionSatisfies checks if the version satisfies the comma-separated version specifiers of PEP 440 such as “>=3.10,<4”.
+func versionSatisfies(versionStr string, specifiers string) (satisfied bool, err error) {
+	defer Catch(&err)
+	version := V(parseVersion(versionStr))
+	for _, specifier := range strings.Split(specifiers, ",") {
+		specifier = strings.TrimSpace(specifier)
+		if specifier == "" {
+			continue
+		}
+		var operator string
+		for _, op := range []string{"===", "~=", "==", "!=", "<=", ">=", "<", ">"} {
+			if strings.HasPrefix(specifier, op) {
+				operator = op
+				break
+			}
+		}
+		if operator == "" {
+			return false, errors.New(fmt.Sprintf("invalid version specifier: %s", specifier))
+		}
+		operand := strings.TrimSpace(specifier[len(operator):])
+		wildcard := strings.HasSuffix(operand, ".*")
+		target := V(parseVersion(strings.TrimSuffix(operand, ".*")))
+		var ok bool
+		switch operator {
+		case "==", "===":
+			ok = Ternary(wildcard, hasPrefix(version, target), compareVersions(version, target) == 0)
+		case "!=":
+			ok = Ternary(wildcard, !hasPrefix(version, target), compareVersions(version, target) != 0)
+		case "<=":
+			ok = compareVersions(version, target) <= 0
+		case ">=":
+			ok = compareVersions(version, target) >= 0
+		case "<":
+			ok = compareVersions(version, target) < 0
+		case ">":
+			ok = compareVersions(version, target) > 0
+		case "~=":
+			// “~=3.10.2” means “>=3.10.2,==3.10.*”.
+			if len(target) < 2 {
+				return false, errors.New(fmt.Sprintf("invalid version specifier: %s", specifier))
+			}
+			ok = compareVersions(version, target) >= 0 && hasPrefix(version, target[:len(target)-1])
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
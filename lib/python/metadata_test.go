@@ -0,0 +1,51 @@
+package python
+
+import (
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadScriptMetadata(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "fetch.py")
+	V0(os.WriteFile(filePath, []byte(`#!/usr/bin/env python3
+# /// script
+# requires-python = ">=3.11"
+# dependencies = [
+#   "requests<3",
+#   "rich",
+# ]
+# ///
+
+import requests
+`), 0644))
+	metadata := V(readScriptMetadata(filePath))
+	assert.Equal(t, []string{"requests<3", "rich"}, metadata.Dependencies)
+	assert.Equal(t, ">=3.11", metadata.RequiresPython)
+
+	V0(os.WriteFile(filePath, []byte("print('hello')\n"), 0644))
+	metadata = V(readScriptMetadata(filePath))
+	assert.Empty(t, metadata.Dependencies)
+}
+
+func TestVersionSatisfies(t *testing.T) {
+	for _, tc := range []struct {
+		version    string
+		specifiers string
+		expected   bool
+	}{
+		{"3.12.1", ">=3.10", true},
+		{"3.9.18", ">=3.10", false},
+		{"3.12.1", ">=3.10,<3.12", false},
+		{"3.12.1", "==3.12.*", true},
+		{"3.11.7", "==3.12.*", false},
+		{"3.12.1", "~=3.12.0", true},
+		{"3.13.0", "~=3.12.0", false},
+		{"3.12.0rc1", ">=3.12", true},
+		{"3.12.1", "!=3.12.1", false},
+	} {
+		assert.Equal(t, tc.expected, V(versionSatisfies(tc.version, tc.specifiers)), "%s %s", tc.version, tc.specifiers)
+	}
+}
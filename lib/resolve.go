@@ -0,0 +1,264 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/samber/lo"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bincDirPaths returns the existing directories to search for commands: the ones listed in $BINCPATH followed by the ones in the configuration.
+func bincDirPaths() []string {
+	dirPaths := strings.Split(os.Getenv("BINCPATH"), ":")
+	if config, err := common.GetConfig(); err == nil {
+		dirPaths = append(dirPaths, config.Path...)
+	}
+	return lo.Uniq(lo.Filter(dirPaths, func(dir string, _ int) bool {
+		stat, err := os.Stat(dir)
+		return err == nil && stat.IsDir()
+	}))
+}
+
+// isExcluded checks if the command in the directory is excluded by the global or the per-directory configuration.
+func isExcluded(name string, dirPath string) bool {
+	var patterns []string
+	if config, err := common.GetConfig(); err == nil {
+		patterns = append(patterns, config.Exclude...)
+	}
+	if dirConfig, err := common.GetDirConfig(dirPath); err == nil {
+		patterns = append(patterns, dirConfig.Exclude...)
+	}
+	return lo.ContainsBy(patterns, func(pattern string) bool {
+		matched, err := filepath.Match(pattern, name)
+		return err == nil && matched
+	})
+}
+
+// aliases returns the aliases of the global configuration merged with the ones of the directories. An earlier definition wins.
+func aliases() (aliasMap map[string]string) {
+	aliasMap = map[string]string{}
+	var configs []*common.Config
+	if config, err := common.GetConfig(); err == nil {
+		configs = append(configs, config)
+	}
+	for _, dirPath := range bincDirPaths() {
+		if dirConfig, err := common.GetDirConfig(dirPath); err == nil {
+			configs = append(configs, dirConfig)
+		}
+	}
+	for _, config := range configs {
+		for alias, name := range config.Aliases {
+			if _, ok := aliasMap[alias]; !ok {
+				aliasMap[alias] = name
+			}
+		}
+	}
+	return aliasMap
+}
+
+// iterateOverManagers calls fn with the manager of every factory for every directory in the order of precedence:
+// directories in the order of $BINCPATH, then factories in descending order of priority weight.
+func iterateOverManagers(
+	fn func(factory *common.Factory, dirPath string, manager common.Manager) error,
+	lastError error,
+) (err error) {
+	defer Catch(&err)
+	for _, dirPath := range bincDirPaths() {
+		for _, factory := range common.Factories() {
+			manager := factory.NewManager(dirPath)
+			if manager == nil {
+				continue
+			}
+			err = fn(factory, dirPath, manager)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return lastError
+}
+
+// candidateT is a source which provides a command.
+type candidateT struct {
+	Name       string
+	SourcePath string
+	Factory    *common.Factory
+	DirPath    string
+	Manager    common.Manager
+}
+
+// resolutionT is the result of resolving a command name to one of the candidates.
+type resolutionT struct {
+	Name     string
+	Winner   *candidateT
+	Shadowed []*candidateT
+	// Pinned is true if the winner is chosen by the configuration rather than by the order of precedence.
+	Pinned bool
+}
+
+// pinMatches checks if the pin in the configuration designates the candidate. A pin is either the name of a manager or the path of a source.
+func pinMatches(pin string, candidate *candidateT) bool {
+	if pin == candidate.Factory.Name {
+		return true
+	}
+	if strings.HasPrefix(pin, "~/") {
+		pin = filepath.Join(V(os.UserHomeDir()), pin[2:])
+	}
+	pinAbs, err := filepath.Abs(pin)
+	if err != nil {
+		return false
+	}
+	sourceAbs, err := filepath.Abs(candidate.SourcePath)
+	if err != nil {
+		return false
+	}
+	return pinAbs == sourceAbs
+}
+
+// newResolution chooses the winner among the candidates, which are in the order of precedence.
+// The first candidate wins unless the configuration pins another one.
+func newResolution(name string, candidates []*candidateT, pins map[string]string) *resolutionT {
+	resolution := &resolutionT{
+		Name:   name,
+		Winner: candidates[0],
+	}
+	if pin, ok := pins[name]; ok {
+		if pinned, found := lo.Find(candidates, func(candidate *candidateT) bool {
+			return pinMatches(pin, candidate)
+		}); found {
+			resolution.Winner = pinned
+			resolution.Pinned = true
+		}
+	}
+	resolution.Shadowed = lo.Filter(candidates, func(candidate *candidateT, _ int) bool {
+		return candidate != resolution.Winner
+	})
+	return resolution
+}
+
+// resolveAll resolves every command discovered in $BINCPATH. The resolutions are in the order in which the commands are first found.
+func resolveAll() (resolutions []*resolutionT, err error) {
+	defer Catch(&err)
+	var names []string
+	candidatesMap := map[string][]*candidateT{}
+	V0(iterateOverManagers(func(factory *common.Factory, dirPath string, manager common.Manager) error {
+		for _, commandBaseInfo := range manager.GetCommandBaseInfoList() {
+			name := commandBaseInfo.CmdBase
+			if isExcluded(name, dirPath) {
+				continue
+			}
+			if _, ok := candidatesMap[name]; !ok {
+				names = append(names, name)
+			}
+			candidatesMap[name] = append(candidatesMap[name], &candidateT{
+				Name:       name,
+				SourcePath: commandBaseInfo.SourcePath,
+				Factory:    factory,
+				DirPath:    dirPath,
+				Manager:    manager,
+			})
+		}
+		return nil
+	}, nil))
+	pins := V(common.GetConfig()).Pins
+	for _, name := range names {
+		resolutions = append(resolutions, newResolution(name, candidatesMap[name], pins))
+	}
+	return resolutions, nil
+}
+
+var errResolved = errors.New("resolved")
+
+// resolve resolves the command name with the discovery index, so that only the directories changed since the last run are scanned
+// and only the managers of the candidates are created. Unless the command is pinned, the search stops at the first candidate.
+// If the index turns out to be stale or has no candidate, the directories are scanned as a fallback.
+func resolve(name string) (resolution *resolutionT, err error) {
+	defer Catch(&err)
+	pins := V(common.GetConfig()).Pins
+	_, pinned := pins[name]
+	dirPaths := bincDirPaths()
+	index := V(updatedIndex(dirPaths, false))
+	var candidates []*candidateT
+outer:
+	for _, dirPath := range dirPaths {
+		for _, indexedCandidate := range index.Dirs[dirPath].Candidates {
+			if indexedCandidate.Name != name || isExcluded(name, dirPath) {
+				continue
+			}
+			factory := common.FactoryByName(indexedCandidate.Factory)
+			if factory == nil {
+				return resolveByScan(name)
+			}
+			manager := factory.NewManager(dirPath)
+			if manager == nil || !manager.CanRun(name) {
+				return resolveByScan(name)
+			}
+			candidate := &candidateT{
+				Name:       name,
+				SourcePath: indexedCandidate.SourcePath,
+				Factory:    factory,
+				DirPath:    dirPath,
+				Manager:    manager,
+			}
+			candidates = append(candidates, candidate)
+			if !pinned || pinMatches(pins[name], candidate) {
+				break outer
+			}
+		}
+	}
+	// The index misses the changes which do not touch the directories it watches, such as a script made executable.
+	if len(candidates) == 0 {
+		return resolveByScan(name)
+	}
+	return newResolution(name, candidates, pins), nil
+}
+
+// resolveByScan resolves the command name by scanning the directories without the index.
+func resolveByScan(name string) (resolution *resolutionT, err error) {
+	defer Catch(&err)
+	pins := V(common.GetConfig()).Pins
+	_, pinned := pins[name]
+	var candidates []*candidateT
+	err = iterateOverManagers(func(factory *common.Factory, dirPath string, manager common.Manager) error {
+		for _, commandBaseInfo := range manager.GetCommandBaseInfoList() {
+			if commandBaseInfo.CmdBase != name || isExcluded(name, dirPath) {
+				continue
+			}
+			candidate := &candidateT{
+				Name:       name,
+				SourcePath: commandBaseInfo.SourcePath,
+				Factory:    factory,
+				DirPath:    dirPath,
+				Manager:    manager,
+			}
+			candidates = append(candidates, candidate)
+			if !pinned || pinMatches(pins[name], candidate) {
+				return errResolved
+			}
+		}
+		return nil
+	}, nil)
+	if err != nil && !errors.Is(err, errResolved) {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New(fmt.Sprintf("no matching command found: %s", name))
+	}
+	return newResolution(name, candidates, pins), nil
+}
+
+// resolveCommandOrAlias resolves the name as a command, or as an alias if no command has the name.
+func resolveCommandOrAlias(name string) (resolution *resolutionT, err error) {
+	resolution, err = resolve(name)
+	if err == nil {
+		return resolution, nil
+	}
+	if aliasedName, ok := aliases()[name]; ok {
+		return resolve(aliasedName)
+	}
+	return nil, err
+}
@@ -0,0 +1,50 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Two directories in $BINCPATH provide the same command, and the earlier one wins unless the other is pinned.
+func TestResolve(t *testing.T) {
+	homeDirPath := filepath.Join(t.TempDir(), "home")
+	common.SetHomeDirPath(homeDirPath)
+	common.ResetConfig()
+	defer common.ResetConfig()
+	t.Setenv("XDG_CONFIG_HOME", "")
+	dirPath1 := filepath.Join(t.TempDir(), "bin1")
+	dirPath2 := filepath.Join(t.TempDir(), "bin2")
+	for _, dirPath := range []string{dirPath1, dirPath2} {
+		V0(os.MkdirAll(dirPath, 0755))
+		V0(os.WriteFile(filepath.Join(dirPath, "hello.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	}
+	t.Setenv("BINCPATH", dirPath1+":"+dirPath2)
+	resolution := V(resolve("hello"))
+	assert.Equal(t, filepath.Join(dirPath1, "hello.go"), resolution.Winner.SourcePath)
+	assert.False(t, resolution.Pinned)
+
+	var buf bytes.Buffer
+	V0(conflicts([]string{"--json"}, &buf))
+	var conflictList []*conflictT
+	V0(json.Unmarshal(buf.Bytes(), &conflictList))
+	assert.Len(t, conflictList, 1)
+	assert.Equal(t, filepath.Join(dirPath1, "hello.go"), conflictList[0].Active.SourcePath)
+	assert.Equal(t, filepath.Join(dirPath2, "hello.go"), conflictList[0].Shadowed[0].SourcePath)
+
+	V0(os.MkdirAll(common.ConfigDirPath(), 0755))
+	V0(os.WriteFile(common.ConfigFilePath(), []byte(`
+[pins]
+hello = "`+filepath.Join(dirPath2, "hello.go")+`"
+`), 0644))
+	common.ResetConfig()
+	resolution = V(resolve("hello"))
+	assert.Equal(t, filepath.Join(dirPath2, "hello.go"), resolution.Winner.SourcePath)
+	assert.True(t, resolution.Pinned)
+	assert.Equal(t, filepath.Join(dirPath1, "hello.go"), resolution.Shadowed[0].SourcePath)
+}
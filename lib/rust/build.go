@@ -0,0 +1,288 @@
+package rust
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+)
+
+// Environment variables which affect the build.
+var buildEnvNames = []string{
+	"RUSTC",
+	"RUSTFLAGS",
+	"RUSTUP_TOOLCHAIN",
+}
+
+// hasEmbeddedManifest returns whether the source is a cargo script with a manifest embedded in its frontmatter or in its doc comment,
+// which only the nightly toolchain runs.
+func hasEmbeddedManifest(rsFilePath string) bool {
+	in, err := os.Open(rsFilePath)
+	if err != nil {
+		return false
+	}
+	defer (func() { Ignore(in.Close()) })()
+	buf := make([]byte, 1024)
+	n, _ := in.Read(buf)
+	head := string(buf[:n])
+	// Skip the shebang line.
+	if strings.HasPrefix(head, "#!") {
+		_, head, _ = strings.Cut(head, "\n")
+	}
+	return strings.HasPrefix(head, "---") || strings.Contains(head, "//! ```cargo")
+}
+
+// findCargoFile returns the nearest manifest in the directory of the sources or above it.
+func findCargoFile(exeLikePath string) (cargoFilePath string, err error) {
+	defer Catch(&err)
+	dirPathPrev := ""
+	dirPath := exeLikePath
+	if !V(os.Stat(exeLikePath)).IsDir() {
+		dirPath = filepath.Dir(exeLikePath)
+	}
+	for dirPath != dirPathPrev {
+		cargoFilePaths := V(filepath.Glob(filepath.Join(dirPath, "Cargo.toml")))
+		if len(cargoFilePaths) > 0 {
+			return cargoFilePaths[0], nil
+		}
+		dirPathPrev = dirPath
+		dirPath = filepath.Dir(dirPath)
+	}
+	return "", errors.New("no cargo file found")
+}
+
+// packageSourcePaths returns the sources of the package in the directory, including the build script, except in the target directory.
+func packageSourcePaths(packageDirPath string) (filePaths []string, err error) {
+	err = filepath.WalkDir(packageDirPath, func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirEntry.IsDir() {
+			if path != packageDirPath && (dirEntry.Name() == "target" || strings.HasPrefix(dirEntry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(path, ".rs") {
+			filePaths = append(filePaths, path)
+		}
+		return nil
+	})
+	return filePaths, err
+}
+
+// crateFilePaths returns the files which affect the build of the crate: the sources and the manifests of the crate and of the other
+// local packages such as the members of the workspace and the path dependencies, and the root manifest and the lockfile of the workspace.
+func crateFilePaths(cargoFilePath string, metadata *cachedCargoBinsT) (filePaths []string, err error) {
+	defer Catch(&err)
+	filePaths = V(packageSourcePaths(filepath.Dir(cargoFilePath)))
+	filePaths = append(filePaths, cargoFilePath)
+	var otherFilePaths []string
+	for _, packageDirPath := range metadata.PackageDirPaths {
+		if packageDirPath == filepath.Dir(cargoFilePath) {
+			continue
+		}
+		otherFilePaths = append(otherFilePaths, V(packageSourcePaths(packageDirPath))...)
+		otherFilePaths = append(otherFilePaths, filepath.Join(packageDirPath, "Cargo.toml"))
+	}
+	for _, base := range []string{"Cargo.toml", "Cargo.lock"} {
+		if filePath := filepath.Join(metadata.WorkspaceDirPath, base); filePath != cargoFilePath {
+			if _, err := os.Stat(filePath); err == nil {
+				otherFilePaths = append(otherFilePaths, filePath)
+			}
+		}
+	}
+	// The directories of the packages may be nested, such as a member in the directory of the root package.
+	slices.Sort(otherFilePaths)
+	for _, filePath := range slices.Compact(otherFilePaths) {
+		if !slices.Contains(filePaths, filePath) {
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	return filePaths, nil
+}
+
+// rustTargetT is how a command is built: as a bin target of a crate with cargo, or as a single source with rustc.
+type rustTargetT struct {
+	cmdBase string
+	// exeLikePath is the source or the directory of the sources which the command is found as.
+	exeLikePath string
+	// cargoFilePath is the manifest of the crate, or an empty string for a single source.
+	cargoFilePath string
+	// packageName is the package of the bin target in the workspace, or an empty string if it is not known.
+	packageName string
+	binName     string
+}
+
+// buildDirPath returns the directory where the toolchain is run, which selects the one in “rust-toolchain.toml” with rustup.
+func (t *rustTargetT) buildDirPath() string {
+	if t.cargoFilePath != "" {
+		return filepath.Dir(t.cargoFilePath)
+	}
+	return filepath.Dir(t.exeLikePath)
+}
+
+// metadataDirPath returns the directory whose metadata lists the local packages of the crate: the crate or the workspace in the search path
+// for its bin targets, which the metadata is cached for when the commands are discovered, or the directory of the manifest otherwise.
+func (t *rustTargetT) metadataDirPath() string {
+	if _, err := os.Stat(filepath.Join(t.exeLikePath, "Cargo.toml")); err == nil {
+		return t.exeLikePath
+	}
+	return filepath.Dir(t.cargoFilePath)
+}
+
+// exeBuildInfo returns the build information of the command, keyed on the files of the crate or the source and on the version of rustc,
+// and the path of the cached executable.
+func exeBuildInfo(target *rustTargetT) (buildInfo *common.BuildInfo, exePath string, err error) {
+	defer Catch(&err)
+	filePaths := []string{target.exeLikePath}
+	if target.cargoFilePath != "" {
+		filePaths = V(crateFilePaths(target.cargoFilePath, V(cargoMetadata(target.metadataDirPath()))))
+	}
+	var fileInfoList []*common.FileInfo
+	for _, filePath := range filePaths {
+		fileInfoList = append(fileInfoList, V(common.GetFileInfo(filePath)))
+	}
+	var env []string
+	for _, name := range buildEnvNames {
+		if value := os.Getenv(name); value != "" {
+			env = append(env, name+"="+value)
+		}
+	}
+	buildInfo = common.NewBuildInfo(
+		V(rustcVersion(target.buildDirPath())),
+		append([]string{target.binName}, common.BuildFlags("rust", filepath.Dir(target.exeLikePath))...),
+		fileInfoList,
+		common.WithEnv(env),
+	)
+	exePath = V(common.CachedExePath(buildInfo.Hash, target.cmdBase))
+	return buildInfo, exePath, nil
+}
+
+// cargoArtifactT is the message of cargo on a built artifact.
+type cargoArtifactT struct {
+	Reason string `json:"reason"`
+	Target struct {
+		Name string   `json:"name"`
+		Kind []string `json:"kind"`
+	} `json:"target"`
+	Executable *string `json:"executable"`
+}
+
+// cargoBuild builds the bin target with cargo and returns the path of the executable in the target directory of the crate.
+func cargoBuild(target *rustTargetT, flags []string) (builtExePath string, err error) {
+	defer Catch(&err)
+	args := []string{
+		"build",
+		"--quiet",
+		"--message-format=json-render-diagnostics",
+		"--manifest-path", target.cargoFilePath,
+		"--bin", target.binName,
+	}
+	if target.packageName != "" {
+		args = append(args, "--package", target.packageName)
+	}
+	cmd := exec.Command(V(cargoCmd()), append(args, flags...)...)
+	cmd.Dir = target.buildDirPath()
+	cmd.Stderr = os.Stderr
+	readCloser := V(cmd.StdoutPipe())
+	V0(cmd.Start())
+	scanner := bufio.NewScanner(readCloser)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var artifact cargoArtifactT
+		if json.Unmarshal(scanner.Bytes(), &artifact) != nil || artifact.Reason != "compiler-artifact" {
+			continue
+		}
+		if artifact.Executable != nil && artifact.Target.Name == target.binName && slices.Contains(artifact.Target.Kind, "bin") {
+			builtExePath = *artifact.Executable
+		}
+	}
+	V0(cmd.Wait())
+	if builtExePath == "" {
+		return "", errors.New(fmt.Sprintf("no executable built: %s", target.binName))
+	}
+	return builtExePath, nil
+}
+
+// copyExecutable copies the executable built in the target directory of the crate into the cache.
+func copyExecutable(srcPath string, dstPath string) (err error) {
+	defer Catch(&err)
+	in := V(os.Open(srcPath))
+	defer (func() { Ignore(in.Close()) })()
+	out := V(os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755))
+	defer (func() { Ignore(out.Close()) })()
+	V0(out.ReadFrom(in))
+	return out.Close()
+}
+
+func ensureExeFile(target *rustTargetT, shouldRebuild bool) (buildInfo *common.BuildInfo, exePath string, err error) {
+	defer Catch(&err)
+	buildInfo, exePath, err = exeBuildInfo(target)
+	if err != nil {
+		return nil, "", err
+	}
+	V0(common.EnsureBuilt(buildInfo, exePath, shouldRebuild, func(tempPath string) (err error) {
+		defer Catch(&err)
+		// The first argument is the name of the bin target.
+		flags := buildInfo.Args[1:]
+		if target.cargoFilePath != "" {
+			return copyExecutable(V(cargoBuild(target, flags)), tempPath)
+		}
+		args := slices.Clone(flags)
+		if !slices.ContainsFunc(args, func(arg string) bool { return strings.HasPrefix(arg, "--edition") }) {
+			args = append(args, "--edition=2021")
+		}
+		args = append(args, "-o", tempPath, target.exeLikePath)
+		cmd := exec.Command(V(rustcCmd()), args...)
+		cmd.Dir = target.buildDirPath()
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}))
+	return buildInfo, exePath, nil
+}
+
+var cargoCmd = sync.OnceValues(func() (cargoPath string, err error) {
+	defer Catch(&err)
+	if path := common.ToolPath("cargo"); path != "" {
+		return path, nil
+	}
+	return V(exec.LookPath("cargo")), nil
+})
+
+var rustcCmd = sync.OnceValues(func() (rustcPath string, err error) {
+	defer Catch(&err)
+	if path := os.Getenv("RUSTC"); path != "" {
+		return path, nil
+	}
+	if path := common.ToolPath("rustc"); path != "" {
+		return path, nil
+	}
+	return V(exec.LookPath("rustc")), nil
+})
+
+var rustcVersions sync.Map
+
+// rustcVersion returns the version of rustc selected for the directory such as “rustc 1.80.1 (3f5fd8dd4 2024-08-06)”.
+func rustcVersion(dirPath string) (version string, err error) {
+	defer Catch(&err)
+	if version, ok := rustcVersions.Load(dirPath); ok {
+		return version.(string), nil
+	}
+	cmd := exec.Command(V(rustcCmd()), "-V")
+	cmd.Dir = dirPath
+	version = strings.TrimSpace(string(V(cmd.Output())))
+	rustcVersions.Store(dirPath, version)
+	return version, nil
+}
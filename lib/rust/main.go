@@ -1,14 +1,12 @@
 package rust
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"sync"
 
 	"github.com/knaka/binc/lib/common"
 	. "github.com/knaka/go-utils"
@@ -17,9 +15,14 @@ import (
 
 type CargoScriptManager struct {
 	exeLikePaths []string
+	// bins are the bin targets of the crates and the workspaces whose manifests are in the directories of the search path.
+	bins []*cargoBinT
 }
 
 var _ common.Manager = &CargoScriptManager{}
+var _ common.CacheChecker = &CargoScriptManager{}
+var _ common.Builder = &CargoScriptManager{}
+var _ common.FastLauncher = &CargoScriptManager{}
 
 // Sort in descending order of length.
 var extensions = []string{
@@ -52,10 +55,35 @@ outer:
 			}
 		}
 	}
+	for _, bin := range m.bins {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    bin.target.cmdBase,
+			SourcePath: bin.srcPath,
+		})
+	}
 	return infoList
 }
 
 func (m *CargoScriptManager) CanRun(cmdBase string) bool {
+	if m.findBin(cmdBase) != nil {
+		return true
+	}
+	_, err := m.findExeLike(cmdBase)
+	return err == nil
+}
+
+// findBin returns the bin target named after the command in the crates of the search path, or nil.
+func (m *CargoScriptManager) findBin(cmdBase string) *rustTargetT {
+	for _, bin := range m.bins {
+		if bin.target.cmdBase == cmdBase {
+			return bin.target
+		}
+	}
+	return nil
+}
+
+// findExeLike returns the directory of the sources or the source which the command is found as.
+func (m *CargoScriptManager) findExeLike(cmdBase string) (exeLikePath string, err error) {
 	for _, exeLikePath := range m.exeLikePaths {
 		exeLikeBase := filepath.Base(exeLikePath)
 		stat, err := os.Stat(exeLikePath)
@@ -63,151 +91,131 @@ func (m *CargoScriptManager) CanRun(cmdBase string) bool {
 			continue
 		}
 		if stat.IsDir() {
-			if filepath.Base(exeLikePath) == cmdBase {
-				return true
+			if exeLikeBase == cmdBase {
+				return exeLikePath, nil
 			}
 		} else {
 			for _, ext := range extensions {
-				if strings.HasSuffix(exeLikeBase, ext) {
-					if exeLikeBase == cmdBase+ext ||
-						exeLikeBase[:len(exeLikeBase)-len(ext)] == cmdBase {
-						return true
-					}
+				if exeLikeBase == cmdBase+ext {
+					return exeLikePath, nil
 				}
 			}
 		}
 	}
-	return false
+	return "", errors.New(fmt.Sprintf("no matching rs file found: %s", cmdBase))
 }
 
-func containsCargoScriptBlockStartMarker(rsFilePath string) bool {
-	in := V(os.Open(rsFilePath))
-	defer func() { V0(in.Close()) }()
-	buf := make([]byte, 1024)
-	n := V(in.Read(buf))
-	return strings.Contains(string(buf[:n]), "{- cargo:")
-}
-
-func findCargoFile(exeLikePath string) (cargoFilePath string, err error) {
+// findTarget returns how the command is built: as a bin target of a crate in the search path, as the bin target named after it
+// in the crate above, or as a single source with rustc. A cargo script with an embedded manifest is returned as nil,
+// as it is run by the nightly toolchain without the cache.
+func (m *CargoScriptManager) findTarget(cmdBase string) (target *rustTargetT, err error) {
 	defer Catch(&err)
-	dirPathPrev := exeLikePath
-	dirPath := filepath.Dir(exeLikePath)
-	for dirPath != dirPathPrev {
-		cargoFilePaths := V(filepath.Glob(filepath.Join(dirPath, "Cargo.toml")))
-		if len(cargoFilePaths) > 0 {
-			return cargoFilePaths[0], nil
+	if target := m.findBin(cmdBase); target != nil {
+		return target, nil
+	}
+	exeLikePath := V(m.findExeLike(cmdBase))
+	target = &rustTargetT{
+		cmdBase:     cmdBase,
+		exeLikePath: exeLikePath,
+		binName:     cmdBase,
+	}
+	if cargoFilePath, err := findCargoFile(exeLikePath); err == nil {
+		target.cargoFilePath = cargoFilePath
+		// The bin target is not necessarily named after the source or its directory.
+		if bin := binOfSource(filepath.Dir(cargoFilePath), exeLikePath); bin != nil {
+			target.cargoFilePath = bin.target.cargoFilePath
+			target.packageName = bin.target.packageName
+			target.binName = bin.target.binName
 		}
-		dirPathPrev = dirPath
-		dirPath = filepath.Dir(dirPath)
+		return target, nil
+	}
+	if V(os.Stat(exeLikePath)).IsDir() {
+		return nil, errors.New("no cargo file found")
+	}
+	if hasEmbeddedManifest(exeLikePath) {
+		return nil, nil
 	}
-	return "", errors.New("no cargo file found")
+	return target, nil
 }
 
-func build(cargoFilePath string, cmdBase string) (exePath string, err error) {
+func (m *CargoScriptManager) Run(args []string, shouldRebuild bool) (err error) {
 	defer Catch(&err)
-	cargoFileDir := filepath.Dir(cargoFilePath)
-	wd := V(os.Getwd())
-	defer (func() { Ignore(os.Chdir(wd)) })()
-	V0(os.Chdir(cargoFileDir))
-	cmd := exec.Command(V(cargoCmd()), "build", cmdBase)
-	readCloser := V(cmd.StdoutPipe())
-	defer (func() { Ignore(readCloser.Close()) })()
-	go (func() {
-		scanner := bufio.NewScanner(readCloser)
-		for {
-			if !scanner.Scan() {
-				break
-			}
-			txt := scanner.Text()
-			if !strings.Contains(txt, "Up to date") {
-				Ignore(os.Stderr.Write([]byte(txt + "\n")))
-			}
+	cmdBase := filepath.Base(args[0])
+	target := V(m.findTarget(cmdBase))
+	var cmd *exec.Cmd
+	if target == nil {
+		cmd = exec.Command(V(cargoCmd()), append([]string{
+			"+nightly",
+			"-Z", "script",
+			"--quiet",
+			V(m.findExeLike(cmdBase)),
+		}, args[1:]...)...)
+	} else {
+		_, exePath, err := ensureExeFile(target, shouldRebuild)
+		if err != nil {
+			return err
 		}
-	})()
+		cmd = exec.Command(exePath, args[1:]...)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	V0(cmd.Run())
-	cmd = exec.Command(V(cargoCmd()), "list-bin", cmdBase)
-	bufExePath := V(cmd.Output())
-	builtExePath := strings.TrimSpace(string(bufExePath))
-	V0(os.Chdir(wd))
-	return builtExePath, nil
+	return common.RunCommand(cmd)
 }
 
-func (m *CargoScriptManager) Run(args []string, shouldRebuild bool) (err error) {
+func (m *CargoScriptManager) Build(cmdBase string, shouldRebuild bool) (err error) {
 	defer Catch(&err)
-	cmdBase := filepath.Base(args[0])
-	for _, exeLikePath := range m.exeLikePaths {
-		exeLikeBase := filepath.Base(exeLikePath)
-		stat, err := os.Stat(exeLikePath)
-		if err != nil {
-			continue
-		}
-		if stat.IsDir() {
-			if filepath.Base(exeLikePath) == cmdBase {
-				if cargoFilePath, err := findCargoFile(exeLikePath); err == nil {
-					cmd := exec.Command(V(cargoCmd()), append([]string{
-						"-Z", "unstable-options",
-						"-C", filepath.Dir(cargoFilePath),
-						"run", "--quiet", "--bin", cmdBase,
-						"--",
-					}, args[1:]...)...)
-					cmd.Stdin = os.Stdin
-					cmd.Stdout = os.Stdout
-					cmd.Stderr = os.Stderr
-					return cmd.Run()
-				} else {
-					return errors.New("no cargo file found")
-				}
-			}
-		} else {
-			for _, ext := range extensions {
-				if exeLikeBase == cmdBase+ext {
-					if cargoFilePath, err := findCargoFile(exeLikePath); err == nil {
-						cmd := exec.Command(V(cargoCmd()), append([]string{
-							"-Z", "unstable-options",
-							"-C", filepath.Dir(cargoFilePath),
-							"run", "--quiet", "--bin", cmdBase,
-						}, args[1:]...)...)
-						cmd.Stdin = os.Stdin
-						cmd.Stdout = os.Stdout
-						cmd.Stderr = os.Stderr
-						return cmd.Run()
-					} else {
-						// cargo +nightly -q -Zscript
-						cmd := exec.Command(V(cargoCmd()), append([]string{
-							"+nightly",
-							"-Z", "script",
-							"--quiet",
-							exeLikePath,
-						}, args[1:]...)...)
-						cmd.Stdin = os.Stdin
-						cmd.Stdout = os.Stdout
-						cmd.Stderr = os.Stderr
-						return cmd.Run()
-						//} else {
-						//	return errors.New("no matching cargo target found")
-					}
-				}
-			}
-		}
+	target := V(m.findTarget(cmdBase))
+	if target == nil {
+		return nil
+	}
+	_, _, err = ensureExeFile(target, shouldRebuild)
+	return err
+}
+
+func (m *CargoScriptManager) CachedPath(cmdBase string) (cachedPath string, err error) {
+	defer Catch(&err)
+	target := V(m.findTarget(cmdBase))
+	if target == nil {
+		return "", errors.New(fmt.Sprintf("not cached: %s", cmdBase))
 	}
-	return errors.New(fmt.Sprintf("no matching rs file found: %s", args[0]))
+	_, cachedPath, err = exeBuildInfo(target)
+	return cachedPath, err
 }
 
-var cargoCmd = sync.OnceValues(func() (cargoPath string, err error) {
+// LaunchStamp returns the stamp to launch the cached executable. Cargo scripts are not supported as they have nothing cached.
+func (m *CargoScriptManager) LaunchStamp(cmdBase string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
 	defer Catch(&err)
-	return V(exec.LookPath("cargo")), nil
-})
+	target := V(m.findTarget(cmdBase))
+	if target == nil {
+		return nil, common.ErrNoLaunchStamp
+	}
+	buildInfo, exePath, err := ensureExeFile(target, shouldRebuild)
+	if err != nil {
+		return nil, err
+	}
+	return common.NewLaunchStamp([]string{exePath}, exePath, buildInfo, buildEnvNames), nil
+}
 
 func newCargoScriptManager(dirPath string) common.Manager {
-	if E(cargoCmd()) != nil {
+	if E(cargoCmd()) != nil && E(rustcCmd()) != nil {
 		return nil
 	}
 	var exeLikePaths []string
+	var bins []*cargoBinT
 	for _, dirEntry := range V(os.ReadDir(dirPath)) {
-		if !dirEntry.IsDir() {
+		if !dirEntry.IsDir() ||
+			strings.HasPrefix(dirEntry.Name(), ".") ||
+			strings.HasPrefix(dirEntry.Name(), "_") {
 			continue
 		}
+		// The commands of a crate or a workspace are its bin targets, which are not necessarily named after the directory.
+		if _, err := os.Stat(filepath.Join(dirPath, dirEntry.Name(), "Cargo.toml")); err == nil && E(cargoCmd()) == nil {
+			if crateBins, err := cargoBins(filepath.Join(dirPath, dirEntry.Name())); err == nil {
+				bins = append(bins, crateBins...)
+				continue
+			}
+		}
 		rsFiles := V(filepath.Glob(filepath.Join(dirPath, dirEntry.Name(), "*.rs")))
 		if len(rsFiles) > 0 {
 			exeLikePaths = append(exeLikePaths, filepath.Join(dirPath, dirEntry.Name()))
@@ -221,11 +229,12 @@ func newCargoScriptManager(dirPath string) common.Manager {
 		return !strings.HasPrefix(filepath.Base(rsFilePath), ".") &&
 			!strings.HasPrefix(filepath.Base(rsFilePath), "_")
 	})
-	if len(exeLikePaths) == 0 {
+	if len(exeLikePaths) == 0 && len(bins) == 0 {
 		return nil
 	}
 	return &CargoScriptManager{
 		exeLikePaths: exeLikePaths,
+		bins:         bins,
 	}
 }
 
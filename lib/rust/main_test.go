@@ -0,0 +1,196 @@
+package rust
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// A single source is compiled with rustc, and a bin target of a crate with cargo, into the cache.
+func TestEnsureExeFile(t *testing.T) {
+	if E(cargoCmd()) != nil || E(rustcCmd()) != nil {
+		t.Skip("no Rust toolchain")
+	}
+	for _, name := range buildEnvNames {
+		// Restored after the test. cargo fails with an empty $RUSTC.
+		t.Setenv(name, "")
+		V0(os.Unsetenv(name))
+	}
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	dirPath := t.TempDir()
+
+	filePath := filepath.Join(dirPath, "hello.rs")
+	V0(os.WriteFile(filePath, []byte("fn main() { println!(\"Hello\"); }\n"), 0644))
+	manager := newCargoScriptManager(dirPath).(*CargoScriptManager)
+	target := V(manager.findTarget("hello"))
+	assert.Empty(t, target.cargoFilePath)
+	_, exePath, err := ensureExeFile(target, false)
+	V0(err)
+	assert.Equal(t, "Hello\n", string(V(exec.Command(exePath).Output())))
+
+	crateDirPath := filepath.Join(dirPath, "greet")
+	V0(os.MkdirAll(filepath.Join(crateDirPath, "src"), 0755))
+	V0(os.WriteFile(filepath.Join(crateDirPath, "Cargo.toml"), []byte(`[package]
+name = "greet"
+version = "0.1.0"
+edition = "2021"
+
+[[bin]]
+name = "greet"
+path = "main.rs"
+`), 0644))
+	V0(os.WriteFile(filepath.Join(crateDirPath, "main.rs"), []byte("mod words;\nfn main() { println!(\"{}\", words::WORD); }\n"), 0644))
+	V0(os.WriteFile(filepath.Join(crateDirPath, "words.rs"), []byte("pub const WORD: &str = \"Hi\";\n"), 0644))
+	manager = newCargoScriptManager(dirPath).(*CargoScriptManager)
+	target = V(manager.findTarget("greet"))
+	assert.Equal(t, filepath.Join(crateDirPath, "Cargo.toml"), target.cargoFilePath)
+	buildInfo, exePath, err := ensureExeFile(target, false)
+	V0(err)
+	assert.Len(t, buildInfo.Files, 3)
+	assert.Equal(t, "Hi\n", string(V(exec.Command(exePath).Output())))
+}
+
+// The bin targets of the members of a workspace are the commands, whatever the directories are named.
+func TestCargoBins(t *testing.T) {
+	if E(cargoCmd()) != nil {
+		t.Skip("no cargo")
+	}
+	for _, name := range buildEnvNames {
+		t.Setenv(name, "")
+		V0(os.Unsetenv(name))
+	}
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	dirPath := t.TempDir()
+	workspaceDirPath := filepath.Join(dirPath, "tools")
+	V0(os.MkdirAll(filepath.Join(workspaceDirPath, "greeter", "src", "bin"), 0755))
+	V0(os.WriteFile(filepath.Join(workspaceDirPath, "Cargo.toml"), []byte("[workspace]\nmembers = [\"greeter\"]\nresolver = \"2\"\n"), 0644))
+	V0(os.WriteFile(filepath.Join(workspaceDirPath, "greeter", "Cargo.toml"), []byte(`[package]
+name = "greeter"
+version = "0.1.0"
+edition = "2021"
+
+[[bin]]
+name = "say-hello"
+path = "src/main.rs"
+`), 0644))
+	V0(os.WriteFile(filepath.Join(workspaceDirPath, "greeter", "src", "main.rs"), []byte("fn main() { println!(\"Hello\"); }\n"), 0644))
+	V0(os.WriteFile(filepath.Join(workspaceDirPath, "greeter", "src", "bin", "say-bye.rs"), []byte("fn main() { println!(\"Bye\"); }\n"), 0644))
+
+	manager := newCargoScriptManager(dirPath).(*CargoScriptManager)
+	var names []string
+	for _, info := range manager.GetCommandBaseInfoList() {
+		names = append(names, info.CmdBase)
+	}
+	assert.ElementsMatch(t, []string{"say-hello", "say-bye"}, names)
+	assert.False(t, manager.CanRun("tools"))
+	target := V(manager.findTarget("say-bye"))
+	assert.Equal(t, "greeter", target.packageName)
+	_, exePath, err := ensureExeFile(target, false)
+	V0(err)
+	assert.Equal(t, "Bye\n", string(V(exec.Command(exePath).Output())))
+
+	// The bin targets are cached until a source of a bin target is added. The build has written the lock file.
+	newCargoScriptManager(dirPath)
+	cached := loadCargoBins(workspaceDirPath)
+	if assert.NotNil(t, cached) {
+		assert.Len(t, cached.Bins, 2)
+	}
+	V0(os.WriteFile(filepath.Join(workspaceDirPath, "greeter", "src", "bin", "say-hi.rs"), []byte("fn main() { println!(\"Hi\"); }\n"), 0644))
+	assert.Nil(t, loadCargoBins(workspaceDirPath))
+	manager = newCargoScriptManager(dirPath).(*CargoScriptManager)
+	assert.True(t, manager.CanRun("say-hi"))
+	assert.NotNil(t, loadCargoBins(workspaceDirPath))
+}
+
+// Editing a library of the workspace which a member depends on changes the cache entry of the bin target of the member.
+func TestExeBuildInfoWorkspace(t *testing.T) {
+	if E(cargoCmd()) != nil || E(rustcCmd()) != nil {
+		t.Skip("no Rust toolchain")
+	}
+	for _, name := range buildEnvNames {
+		t.Setenv(name, "")
+		V0(os.Unsetenv(name))
+	}
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	dirPath := t.TempDir()
+	workspaceDirPath := filepath.Join(dirPath, "tools")
+	V0(os.MkdirAll(filepath.Join(workspaceDirPath, "greeter", "src"), 0755))
+	V0(os.MkdirAll(filepath.Join(workspaceDirPath, "words", "src"), 0755))
+	V0(os.WriteFile(filepath.Join(workspaceDirPath, "Cargo.toml"), []byte("[workspace]\nmembers = [\"greeter\", \"words\"]\nresolver = \"2\"\n"), 0644))
+	V0(os.WriteFile(filepath.Join(workspaceDirPath, "greeter", "Cargo.toml"), []byte(`[package]
+name = "greeter"
+version = "0.1.0"
+edition = "2021"
+
+[dependencies]
+words = { path = "../words" }
+`), 0644))
+	V0(os.WriteFile(filepath.Join(workspaceDirPath, "greeter", "src", "main.rs"), []byte("fn main() { println!(\"{}\", words::WORD); }\n"), 0644))
+	V0(os.WriteFile(filepath.Join(workspaceDirPath, "words", "Cargo.toml"), []byte("[package]\nname = \"words\"\nversion = \"0.1.0\"\nedition = \"2021\"\n"), 0644))
+	V0(os.WriteFile(filepath.Join(workspaceDirPath, "words", "src", "lib.rs"), []byte("pub const WORD: &str = \"Hi\";\n"), 0644))
+
+	manager := newCargoScriptManager(dirPath).(*CargoScriptManager)
+	target := V(manager.findTarget("greeter"))
+	assert.Equal(t, workspaceDirPath, target.metadataDirPath())
+	buildInfo, _, err := exeBuildInfo(target)
+	V0(err)
+	assert.Contains(t, strings.Join(buildInfo.Files, "\n"), filepath.Join(workspaceDirPath, "Cargo.toml"))
+
+	V0(os.WriteFile(filepath.Join(workspaceDirPath, "words", "src", "lib.rs"), []byte("pub const WORD: &str = \"Hello\";\n"), 0644))
+	otherBuildInfo, _, err := exeBuildInfo(V(newCargoScriptManager(dirPath).(*CargoScriptManager).findTarget("greeter")))
+	V0(err)
+	assert.NotEqual(t, buildInfo.HashStr, otherBuildInfo.HashStr)
+}
+
+// Editing a path dependency outside the crate, or the path dependency of it, changes the cache entry of the command.
+func TestExeBuildInfoPathDependency(t *testing.T) {
+	if E(cargoCmd()) != nil || E(rustcCmd()) != nil {
+		t.Skip("no Rust toolchain")
+	}
+	for _, name := range buildEnvNames {
+		t.Setenv(name, "")
+		V0(os.Unsetenv(name))
+	}
+	common.SetHomeDirPath(filepath.Join(t.TempDir(), "home"))
+	dirPath := t.TempDir()
+	writeCrate := func(name string, deps string, src string) {
+		crateDirPath := filepath.Join(dirPath, name)
+		V0(os.MkdirAll(filepath.Join(crateDirPath, "src"), 0755))
+		V0(os.WriteFile(filepath.Join(crateDirPath, "Cargo.toml"), []byte(`[package]
+name = "`+name+`"
+version = "0.1.0"
+edition = "2021"
+
+[dependencies]
+`+deps), 0644))
+		V0(os.WriteFile(filepath.Join(crateDirPath, "src", src), []byte("pub fn word() -> &'static str { \"Hi\" }\n"), 0644))
+	}
+	writeCrate("app", "words = { path = \"../words\" }\n", "main.rs")
+	writeCrate("words", "letters = { path = \"../letters\" }\n", "lib.rs")
+	writeCrate("letters", "", "lib.rs")
+	target := &rustTargetT{
+		cmdBase:       "app",
+		exeLikePath:   filepath.Join(dirPath, "app"),
+		cargoFilePath: filepath.Join(dirPath, "app", "Cargo.toml"),
+		binName:       "app",
+	}
+	buildInfo, _, err := exeBuildInfo(target)
+	V0(err)
+	assert.Contains(t, strings.Join(buildInfo.Files, "\n"), filepath.Join(dirPath, "letters", "src", "lib.rs"))
+
+	V0(os.WriteFile(filepath.Join(dirPath, "words", "src", "lib.rs"), []byte("pub fn word() -> &'static str { \"Hello\" }\n"), 0644))
+	wordsBuildInfo, _, err := exeBuildInfo(target)
+	V0(err)
+	assert.NotEqual(t, buildInfo.HashStr, wordsBuildInfo.HashStr)
+
+	V0(os.WriteFile(filepath.Join(dirPath, "letters", "src", "lib.rs"), []byte("pub fn letter() -> char { 'H' }\n"), 0644))
+	lettersBuildInfo, _, err := exeBuildInfo(target)
+	V0(err)
+	assert.NotEqual(t, wordsBuildInfo.HashStr, lettersBuildInfo.HashStr)
+}
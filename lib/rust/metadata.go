@@ -0,0 +1,230 @@
+package rust
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+)
+
+// cargoMetadataT is the part of the output of “cargo metadata” which binc uses.
+type cargoMetadataT struct {
+	Packages []struct {
+		Name         string `json:"name"`
+		ManifestPath string `json:"manifest_path"`
+		Targets      []struct {
+			Name    string   `json:"name"`
+			Kind    []string `json:"kind"`
+			SrcPath string   `json:"src_path"`
+		} `json:"targets"`
+		Dependencies []struct {
+			// Path is the directory of a path dependency, or empty for the others.
+			Path string `json:"path"`
+		} `json:"dependencies"`
+	} `json:"packages"`
+	WorkspaceRoot string `json:"workspace_root"`
+}
+
+// runCargoMetadata runs “cargo metadata” for the packages of the workspace of the manifest, without resolving the dependencies.
+func runCargoMetadata(cargoFilePath string) (metadata *cargoMetadataT, err error) {
+	defer Catch(&err)
+	cmd := exec.Command(V(cargoCmd()),
+		"metadata",
+		"--format-version", "1",
+		"--no-deps",
+		"--offline",
+		"--manifest-path", cargoFilePath,
+	)
+	cmd.Dir = filepath.Dir(cargoFilePath)
+	metadata = &cargoMetadataT{}
+	V0(json.Unmarshal(V(cmd.Output()), metadata))
+	return metadata, nil
+}
+
+// cargoBinT is a bin target of a crate in a directory of the search path.
+type cargoBinT struct {
+	target  *rustTargetT
+	srcPath string
+}
+
+// cargoBinsDirBase is the base name of the directory in the links directory which caches the bin targets of the crates,
+// so that “cargo metadata” is not run on every invocation.
+const cargoBinsDirBase = ".cargo_bins"
+
+// cachedCargoBinT is a bin target recorded in the cache.
+type cachedCargoBinT struct {
+	Name          string `json:"name"`
+	PackageName   string `json:"package_name"`
+	CargoFilePath string `json:"cargo_file_path"`
+	SrcPath       string `json:"src_path"`
+}
+
+// cachedCargoBinsT holds the bin targets of a crate or a workspace, and the states of the files which change them at the time:
+// the manifests, the lock file, and the directories where cargo discovers the targets and the members.
+type cachedCargoBinsT struct {
+	Files []*common.FileStat `json:"files"`
+	Bins  []*cachedCargoBinT `json:"bins"`
+	// PackageDirPaths are the directories of the local packages: the members of the workspace and the path dependencies, transitively.
+	PackageDirPaths []string `json:"package_dir_paths"`
+	// WorkspaceDirPath is the directory of the root manifest and the lockfile of the workspace.
+	WorkspaceDirPath string `json:"workspace_dir_path"`
+}
+
+func cargoBinsCacheFilePath(crateDirPath string) (filePath string, err error) {
+	defer Catch(&err)
+	hash := sha1.Sum([]byte(V(filepath.Abs(crateDirPath))))
+	return filepath.Join(V(common.LinksDirPath()), cargoBinsDirBase, hex.EncodeToString(hash[:])+".json"), nil
+}
+
+// loadCargoBins returns the cached bin targets of the crate, or nil if they are not cached or the files have changed since.
+func loadCargoBins(crateDirPath string) (cached *cachedCargoBinsT) {
+	filePath, err := cargoBinsCacheFilePath(crateDirPath)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	cached = &cachedCargoBinsT{}
+	// The caches written before the local packages were recorded have none of them.
+	if err := json.Unmarshal(data, cached); err != nil || len(cached.Files) == 0 || len(cached.PackageDirPaths) == 0 {
+		return nil
+	}
+	for _, fileStat := range cached.Files {
+		if *common.GetFileStat(fileStat.Path) != *fileStat {
+			return nil
+		}
+	}
+	return cached
+}
+
+func saveCargoBins(crateDirPath string, cached *cachedCargoBinsT) (err error) {
+	defer Catch(&err)
+	filePath := V(cargoBinsCacheFilePath(crateDirPath))
+	V0(os.MkdirAll(filepath.Dir(filePath), 0755))
+	return common.WriteFileAtomically(filePath, V(json.Marshal(cached)), 0644)
+}
+
+// readCargoMetadata runs “cargo metadata” for the bin targets and the local packages of the crate, and returns them with the files which change them.
+func readCargoMetadata(crateDirPath string) (cached *cachedCargoBinsT, err error) {
+	defer Catch(&err)
+	metadata := V(runCargoMetadata(filepath.Join(crateDirPath, "Cargo.toml")))
+	cached = &cachedCargoBinsT{
+		WorkspaceDirPath: metadata.WorkspaceRoot,
+	}
+	filePaths := []string{
+		filepath.Join(crateDirPath, "Cargo.toml"),
+		filepath.Join(crateDirPath, "Cargo.lock"),
+	}
+	visited := map[string]bool{}
+	var depDirPaths []string
+	for _, pkg := range metadata.Packages {
+		packageDirPath := filepath.Dir(pkg.ManifestPath)
+		visited[packageDirPath] = true
+		cached.PackageDirPaths = append(cached.PackageDirPaths, packageDirPath)
+		// The directories of the members are watched for the members added by a glob pattern.
+		filePaths = append(filePaths,
+			pkg.ManifestPath,
+			filepath.Dir(packageDirPath),
+			packageDirPath,
+			filepath.Join(packageDirPath, "src"),
+			filepath.Join(packageDirPath, "src", "bin"),
+		)
+		for _, dep := range pkg.Dependencies {
+			if dep.Path != "" {
+				depDirPaths = append(depDirPaths, dep.Path)
+			}
+		}
+		for _, target := range pkg.Targets {
+			if !slices.Contains(target.Kind, "bin") {
+				continue
+			}
+			cached.Bins = append(cached.Bins, &cachedCargoBinT{
+				Name:          target.Name,
+				PackageName:   pkg.Name,
+				CargoFilePath: pkg.ManifestPath,
+				SrcPath:       target.SrcPath,
+			})
+		}
+	}
+	// The path dependencies outside the workspace, whose manifests may add more of them.
+	for len(depDirPaths) > 0 {
+		depDirPath := depDirPaths[0]
+		depDirPaths = depDirPaths[1:]
+		if visited[depDirPath] {
+			continue
+		}
+		visited[depDirPath] = true
+		cached.PackageDirPaths = append(cached.PackageDirPaths, depDirPath)
+		depCargoFilePath := filepath.Join(depDirPath, "Cargo.toml")
+		filePaths = append(filePaths, depCargoFilePath)
+		for _, pkg := range V(runCargoMetadata(depCargoFilePath)).Packages {
+			if filepath.Dir(pkg.ManifestPath) != depDirPath {
+				continue
+			}
+			for _, dep := range pkg.Dependencies {
+				if dep.Path != "" {
+					depDirPaths = append(depDirPaths, dep.Path)
+				}
+			}
+		}
+	}
+	slices.Sort(filePaths)
+	for _, filePath := range slices.Compact(filePaths) {
+		cached.Files = append(cached.Files, common.GetFileStat(filePath))
+	}
+	return cached, nil
+}
+
+// cargoMetadata returns the bin targets and the local packages of the crate or the workspace. They are read from the cache while it is valid.
+func cargoMetadata(crateDirPath string) (cached *cachedCargoBinsT, err error) {
+	defer Catch(&err)
+	if cached = loadCargoBins(crateDirPath); cached != nil {
+		return cached, nil
+	}
+	cached = V(readCargoMetadata(crateDirPath))
+	// The cache is only a shortcut, so failing to persist it is not fatal.
+	Ignore(saveCargoBins(crateDirPath, cached))
+	return cached, nil
+}
+
+// cargoBins returns the bin targets of the crate or of the members of the workspace whose manifest is in the directory,
+// including the ones named in “[[bin]]” sections and the ones in “src/bin”. They are read from the cache while it is valid.
+func cargoBins(crateDirPath string) (bins []*cargoBinT, err error) {
+	defer Catch(&err)
+	for _, bin := range V(cargoMetadata(crateDirPath)).Bins {
+		bins = append(bins, &cargoBinT{
+			target: &rustTargetT{
+				cmdBase:       bin.Name,
+				exeLikePath:   crateDirPath,
+				cargoFilePath: bin.CargoFilePath,
+				packageName:   bin.PackageName,
+				binName:       bin.Name,
+			},
+			srcPath: bin.SrcPath,
+		})
+	}
+	return bins, nil
+}
+
+// binOfSource returns the bin target of the crate whose main source is the file or is in the directory, or nil if there is none.
+func binOfSource(crateDirPath string, exeLikePath string) *cargoBinT {
+	bins, err := cargoBins(crateDirPath)
+	if err != nil {
+		return nil
+	}
+	for _, bin := range bins {
+		if bin.srcPath == exeLikePath || strings.HasPrefix(bin.srcPath, exeLikePath+string(filepath.Separator)) {
+			return bin
+		}
+	}
+	return nil
+}
@@ -1,27 +1,29 @@
 package scala
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/knaka/binc/lib/common"
 	. "github.com/knaka/go-utils"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
 	"strings"
 	"sync"
 )
 
 type ScalaFileManager struct {
-	scalacCmd string
-	javaCmd   string
-	filePaths []string
+	javaCmd     string
+	targetPaths []string
 }
 
 var _ common.Manager = &ScalaFileManager{}
+var _ common.CacheChecker = &ScalaFileManager{}
+var _ common.Builder = &ScalaFileManager{}
+var _ common.FastLauncher = &ScalaFileManager{}
 
 var extensions = []string{
 	".sc",
@@ -55,76 +57,194 @@ func kebab2Camel(sIn string) (s string) {
 
 }
 
-func (m *ScalaFileManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
-	for _, javaFilePath := range m.filePaths {
-		javaFileBase := filepath.Base(javaFilePath)
-		for _, ext := range extensions {
-			if strings.HasSuffix(javaFileBase, ext) {
-				infoList = append(infoList, &common.CommandBaseInfo{
-					CmdBase:    camel2Kebab(javaFileBase[:len(javaFileBase)-len(ext)]),
-					SourcePath: javaFilePath,
-				})
-			}
+func (m *ScalaFileManager) findTarget(cmdBase string) (targetPath string, err error) {
+	for _, targetPath := range m.targetPaths {
+		if cmdBaseOf(targetPath) == cmdBase {
+			return targetPath, nil
 		}
 	}
+	return "", errors.New(fmt.Sprintf("no matching scala file found: %s", cmdBase))
+}
+
+func (m *ScalaFileManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
+	for _, targetPath := range m.targetPaths {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    cmdBaseOf(targetPath),
+			SourcePath: targetPath,
+		})
+	}
 	return infoList
 }
 
 func (m *ScalaFileManager) CanRun(cmdBase string) bool {
-	for _, hsFilePath := range m.filePaths {
-		for _, ext := range extensions {
-			if filepath.Base(hsFilePath) == kebab2Camel(cmdBase)+ext {
-				return true
-			}
-		}
-	}
-	return false
+	_, err := m.findTarget(cmdBase)
+	return err == nil
 }
 
-func ensureClassFile(javaFilePath string, cmdBase string, shouldRebuild bool) (classFilePath string, err error) {
+// artifactT is what the sources are built into in the cache: a jar assembled by scala-cli, or the class files compiled by scalac.
+type artifactT struct {
+	buildInfo  *common.BuildInfo
+	cachedPath string
+	command    []string
+}
+
+// newArtifact returns the artifact of the sources, keyed on the sources and the version of the tool which builds them.
+// scala-cli is preferred, as it honors the directives such as “//> using dep” and “//> using scala”.
+func (m *ScalaFileManager) newArtifact(target *scalaTargetT) (artifact *artifactT, err error) {
+	defer Catch(&err)
 	var fileInfoList []*common.FileInfo
-	fileInfoList = append(fileInfoList, V(common.GetFileInfo(javaFilePath)))
-	buildInfo := common.NewBuildInfo(
-		"",  // TODO: Decide if the version of Javac or Java should be recorded
-		nil, // Any arguments?
-		fileInfoList,
-	)
-	classFilePath = V(common.CachedExePath(buildInfo.Hash, kebab2Camel(cmdBase)+".class"))
-	if _, err = os.Stat(classFilePath); err != nil || shouldRebuild {
-		V0(os.MkdirAll(filepath.Dir(classFilePath), 0755))
-		cmd := exec.Command(V(scalacCommand()), "-d", filepath.Dir(classFilePath), javaFilePath)
-		cmd.Stdout = os.Stderr
-		cmd.Stderr = os.Stderr
-		V0(cmd.Run())
-		buildInfoJson := V(json.Marshal(buildInfo))
-		V0(os.WriteFile(V(common.InfoFilePath(buildInfo.Hash)), buildInfoJson, 0644))
-		log.Println("built:", classFilePath)
+	for _, sourcePath := range target.sourcePaths {
+		fileInfoList = append(fileInfoList, V(common.GetFileInfo(sourcePath)))
+	}
+	args := common.BuildFlags("scala", filepath.Dir(target.path))
+	artifact = &artifactT{}
+	if scalaCliCmd, err := scalaCliCommand(); err == nil {
+		artifact.buildInfo = common.NewBuildInfo(V(toolVersion(scalaCliCmd, "version")), args, fileInfoList)
+		artifact.cachedPath = V(common.CachedExePath(artifact.buildInfo.Hash, target.cmdBase+".jar"))
+		artifact.command = []string{m.javaCmd, "-jar", artifact.cachedPath}
+		return artifact, nil
+	}
+	if directives := V(usingDirectives(target.sourcePaths)); len(directives) > 0 {
+		return nil, errors.New(fmt.Sprintf("scala-cli is required for the directives: %s", strings.Join(directives, ", ")))
+	}
+	if strings.HasSuffix(target.path, ".sc") {
+		return nil, errors.New(fmt.Sprintf("scala-cli is required for the script: %s", target.path))
+	}
+	scalacCmd := V(scalacCommand())
+	artifact.buildInfo = common.NewBuildInfo(V(toolVersion(scalacCmd, "-version")), args, fileInfoList)
+	// All the class files compiled from the sources are placed in the “classes” directory.
+	artifact.cachedPath = V(common.CachedExePath(artifact.buildInfo.Hash, "classes"))
+	artifact.command = append(V(classesRunner(scalacCmd, artifact.cachedPath)), V(findMainClass(target)))
+	return artifact, nil
+}
+
+// build builds the sources into the temporary path.
+func (a *artifactT) build(target *scalaTargetT, tempPath string) (err error) {
+	defer Catch(&err)
+	var cmd *exec.Cmd
+	if scalaCliCmd, err := scalaCliCommand(); err == nil {
+		// Keep the “.scala-build” directory of scala-cli out of the directory of the sources.
+		workspacePath := V(os.MkdirTemp("", "binc-scala-cli"))
+		defer (func() { Ignore(os.RemoveAll(workspacePath)) })()
+		args := []string{"--power", "package", "--assembly", "--preamble=false", "--workspace", workspacePath, "-o", tempPath}
+		args = append(append(args, a.buildInfo.Args...), target.path)
+		cmd = exec.Command(scalaCliCmd, args...)
+	} else {
+		V0(os.MkdirAll(tempPath, 0755))
+		args := append(slices.Clone(a.buildInfo.Args), "-d", tempPath)
+		cmd = exec.Command(V(scalacCommand()), append(args, target.sourcePaths...)...)
+	}
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (m *ScalaFileManager) ensureArtifact(target *scalaTargetT, shouldRebuild bool) (artifact *artifactT, err error) {
+	defer Catch(&err)
+	artifact = V(m.newArtifact(target))
+	V0(common.EnsureBuilt(artifact.buildInfo, artifact.cachedPath, shouldRebuild, func(tempPath string) error {
+		return artifact.build(target, tempPath)
+	}))
+	return artifact, nil
+}
+
+func (m *ScalaFileManager) Build(cmdBase string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	_ = V(m.ensureArtifact(V(newScalaTarget(V(m.findTarget(cmdBase)))), shouldRebuild))
+	return nil
+}
+
+func (m *ScalaFileManager) CachedPath(cmdBase string) (cachedPath string, err error) {
+	defer Catch(&err)
+	return V(m.newArtifact(V(newScalaTarget(V(m.findTarget(cmdBase)))))).cachedPath, nil
+}
+
+func (m *ScalaFileManager) LaunchStamp(cmdBase string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
+	defer Catch(&err)
+	artifact := V(m.ensureArtifact(V(newScalaTarget(V(m.findTarget(cmdBase)))), shouldRebuild))
+	var toolPaths []string
+	if scalaCliCmd, err := scalaCliCommand(); err == nil {
+		toolPaths = append(toolPaths, scalaCliCmd)
+	} else {
+		toolPaths = append(toolPaths, V(scalacCommand()))
 	}
-	return classFilePath, nil
+	return common.NewLaunchStamp(
+		artifact.command,
+		artifact.cachedPath,
+		artifact.buildInfo,
+		[]string{"SCALA_HOME"},
+		append(toolPaths, m.javaCmd)...,
+	), nil
 }
 
 func (m *ScalaFileManager) Run(args []string, shouldRebuild bool) (err error) {
 	defer Catch(&err)
-	cmdBase := filepath.Base(args[0])
-	for _, javaFilePath := range m.filePaths {
-		for _, ext := range extensions {
-			if filepath.Base(javaFilePath) == kebab2Camel(cmdBase)+ext {
-				classFilePath := V(ensureClassFile(javaFilePath, cmdBase, shouldRebuild))
-				classDir := filepath.Dir(classFilePath)
-				classBase := kebab2Camel(cmdBase)
-				classPath := strings.Join([]string{
-					classDir,
-					filepath.Join(V(scalaHome()), "lib", "*"),
-				}, ":")
-				cmd := exec.Command(m.javaCmd, append([]string{"-cp", classPath, classBase}, args[1:]...)...)
-				cmd.Stdin = os.Stdin
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				return cmd.Run()
-			}
+	artifact := V(m.ensureArtifact(V(newScalaTarget(V(m.findTarget(filepath.Base(args[0]))))), shouldRebuild))
+	cmd := exec.Command(artifact.command[0], append(artifact.command[1:], args[1:]...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return common.RunCommand(cmd)
+}
+
+// classesRunner returns the command line to run the class files compiled by scalac: java with the libraries of $SCALA_HOME
+// if it has them as Scala 2 distributions do, or the runner next to the compiler.
+func classesRunner(scalacPath string, classesDirPath string) (command []string, err error) {
+	defer Catch(&err)
+	if scalaHome, err := scalaHome(); err == nil {
+		if _, err := os.Stat(filepath.Join(scalaHome, "lib")); err == nil {
+			classPath := strings.Join([]string{
+				classesDirPath,
+				filepath.Join(scalaHome, "lib", "*"),
+			}, string(os.PathListSeparator))
+			return []string{V(javaCommand()), "-cp", classPath}, nil
 		}
 	}
-	return errors.New(fmt.Sprintf("no matching java file found: %s", args[0]))
+	scalaPath := filepath.Join(filepath.Dir(scalacPath), strings.Replace(filepath.Base(scalacPath), "scalac", "scala", 1))
+	if _, err := os.Stat(scalaPath); err != nil {
+		scalaPath = V(lookupTool("scala"))
+	}
+	return []string{scalaPath, "-classpath", classesDirPath}, nil
+}
+
+var toolVersions sync.Map
+
+// toolVersion returns the version output of the tool such as “Scala compiler version 3.3.3 -- Copyright 2002-2024, LAMP/EPFL” in a line.
+func toolVersion(toolPath string, versionArg string) (version string, err error) {
+	defer Catch(&err)
+	if version, ok := toolVersions.Load(toolPath); ok {
+		return version.(string), nil
+	}
+	output := string(V(exec.Command(toolPath, versionArg).CombinedOutput()))
+	version = strings.Join(strings.Fields(output), " ")
+	toolVersions.Store(toolPath, version)
+	return version, nil
+}
+
+// coursierBinDirPath returns the directory where coursier installs the launchers of the tools.
+func coursierBinDirPath() string {
+	if dirPath := os.Getenv("COURSIER_BIN_DIR"); dirPath != "" {
+		return dirPath
+	}
+	switch runtime.GOOS {
+	case "windows":
+		return filepath.Join(os.Getenv("LOCALAPPDATA"), "Coursier", "data", "bin")
+	case "darwin":
+		return common.ExpandHome("~/Library/Application Support/Coursier/bin")
+	default:
+		return common.ExpandHome("~/.local/share/coursier/bin")
+	}
+}
+
+// lookupTool returns the path of the tool configured, found on $PATH, or installed by coursier.
+func lookupTool(name string) (toolPath string, err error) {
+	if path := common.ToolPath(name); path != "" {
+		return path, nil
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	return exec.LookPath(filepath.Join(coursierBinDirPath(), name))
 }
 
 var scalaHome = sync.OnceValues(func() (scalaHome string, err error) {
@@ -133,39 +253,67 @@ var scalaHome = sync.OnceValues(func() (scalaHome string, err error) {
 	if scalaHome != "" {
 		return scalaHome, nil
 	}
+	if scalaHome = common.ToolPath("scala_home"); scalaHome != "" {
+		return scalaHome, nil
+	}
 	return "", errors.New("$SCALA_HOME is not set")
 })
 
-var scalacCommand = sync.OnceValues(func() (cabalPath string, err error) {
-	defer Catch(&err)
-	return filepath.Join(V(scalaHome()), "bin", "scalac"), nil
+var scalaCliCommand = sync.OnceValues(func() (scalaCliPath string, err error) {
+	return lookupTool("scala-cli")
+})
+
+var scalacCommand = sync.OnceValues(func() (scalacPath string, err error) {
+	if path := common.ToolPath("scalac"); path != "" {
+		return path, nil
+	}
+	if scalaHome, err := scalaHome(); err == nil {
+		return filepath.Join(scalaHome, "bin", "scalac"), nil
+	}
+	return lookupTool("scalac")
 })
 
 var javaCommand = sync.OnceValues(func() (cabalPath string, err error) {
 	defer Catch(&err)
+	if path := common.ToolPath("java"); path != "" {
+		return path, nil
+	}
 	return V(exec.LookPath("java")), nil
 })
 
 func newScalaFileManager(dirPath string) common.Manager {
-	scalacCmd, err := scalacCommand()
-	if err != nil {
-		return nil
+	if _, err := scalaCliCommand(); err != nil {
+		if _, err := scalacCommand(); err != nil {
+			return nil
+		}
 	}
 	javaCmd, err := javaCommand()
 	if err != nil {
 		return nil
 	}
-	var matchedPaths []string
-	for _, ext := range extensions {
-		matchedPaths = append(matchedPaths, V(filepath.Glob(filepath.Join(dirPath, "*"+ext)))...)
+	var targetPaths []string
+	for _, dirEntry := range V(os.ReadDir(dirPath)) {
+		if strings.HasPrefix(dirEntry.Name(), "_") ||
+			strings.HasPrefix(dirEntry.Name(), ".") {
+			continue
+		}
+		targetPath := filepath.Join(dirPath, dirEntry.Name())
+		if !dirEntry.IsDir() {
+			if isSourceFile(targetPath) {
+				targetPaths = append(targetPaths, targetPath)
+			}
+			continue
+		}
+		if isCommandDir(targetPath) {
+			targetPaths = append(targetPaths, targetPath)
+		}
 	}
-	if len(matchedPaths) == 0 {
+	if len(targetPaths) == 0 {
 		return nil
 	}
 	return &ScalaFileManager{
-		scalacCmd: scalacCmd,
-		javaCmd:   javaCmd,
-		filePaths: matchedPaths,
+		javaCmd:     javaCmd,
+		targetPaths: targetPaths,
 	}
 }
 
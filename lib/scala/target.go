@@ -0,0 +1,191 @@
+package scala
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/knaka/go-utils"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// scalaTargetT is a command made of a source file or of the sources in a directory.
+type scalaTargetT struct {
+	path        string
+	cmdBase     string
+	sourcePaths []string
+}
+
+func cmdBaseOf(targetPath string) string {
+	base := filepath.Base(targetPath)
+	for _, ext := range extensions {
+		if strings.HasSuffix(base, ext) {
+			return camel2Kebab(base[:len(base)-len(ext)])
+		}
+	}
+	return base
+}
+
+func isSourceFile(filePath string) bool {
+	for _, ext := range extensions {
+		if strings.HasSuffix(filePath, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetDirBase is the base name of the directory of the outputs of sbt and Maven, which may have generated sources.
+const targetDirBase = "target"
+
+// dirSourceFiles returns the sources in the directory and in its subdirectories, except in the hidden ones such as “.scala-build”
+// and in the directories of the outputs.
+func dirSourceFiles(dirPath string) (filePaths []string, err error) {
+	err = filepath.WalkDir(dirPath, func(path string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dirEntry.IsDir() {
+			if path != dirPath && (dirEntry.Name() == targetDirBase || strings.HasPrefix(dirEntry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isSourceFile(path) {
+			filePaths = append(filePaths, path)
+		}
+		return nil
+	})
+	return filePaths, err
+}
+
+// Files of the build tools whose projects are not commands, even with the sources in them.
+var buildToolFileBases = []string{
+	"build.sbt",
+	"build.sc",
+	"build.mill",
+	"pom.xml",
+	"build.gradle",
+	"build.gradle.kts",
+	"settings.gradle",
+	"settings.gradle.kts",
+}
+
+// isCommandDir checks if the directory is a command: it has sources directly in it or under “src”,
+// and it is not a project of sbt, Mill, Maven or Gradle.
+func isCommandDir(dirPath string) bool {
+	for _, base := range buildToolFileBases {
+		if _, err := os.Stat(filepath.Join(dirPath, base)); err == nil {
+			return false
+		}
+	}
+	for _, ext := range extensions {
+		if filePaths, err := filepath.Glob(filepath.Join(dirPath, "*"+ext)); err == nil && len(filePaths) > 0 {
+			return true
+		}
+	}
+	sourcePaths, err := dirSourceFiles(filepath.Join(dirPath, "src"))
+	return err == nil && len(sourcePaths) > 0
+}
+
+func newScalaTarget(targetPath string) (target *scalaTargetT, err error) {
+	defer Catch(&err)
+	target = &scalaTargetT{
+		path:    targetPath,
+		cmdBase: cmdBaseOf(targetPath),
+	}
+	if V(os.Stat(targetPath)).IsDir() {
+		target.sourcePaths = V(dirSourceFiles(targetPath))
+	} else {
+		target.sourcePaths = []string{targetPath}
+	}
+	return target, nil
+}
+
+// reUsingDirective matches the directives of scala-cli such as “//> using dep com.lihaoyi::os-lib:0.10.0”.
+var reUsingDirective = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^\s*//>\s*using\s+(\S+)`)
+})
+
+var rePackage = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)\s*$`)
+})
+
+// reMainMethod matches the main methods of Scala 3 such as “@main def hello()”.
+var reMainMethod = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`@main\s+def\s+(\w+)`)
+})
+
+// reAppObject matches the objects extending App.
+var reAppObject = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`\bobject\s+(\w+)\s+extends\s+App\b`)
+})
+
+// reObject and reDefMain find the object with a main method such as “def main(args: Array[String]): Unit”.
+var reObject = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`\bobject\s+(\w+)`)
+})
+
+var reDefMain = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`\bdef\s+main\s*\(`)
+})
+
+// usingDirectives returns the names of the scala-cli directives in the sources such as “dep” and “scala”.
+func usingDirectives(sourcePaths []string) (names []string, err error) {
+	defer Catch(&err)
+	for _, sourcePath := range sourcePaths {
+		for _, match := range reUsingDirective().FindAllStringSubmatch(string(V(os.ReadFile(sourcePath))), -1) {
+			names = append(names, match[1])
+		}
+	}
+	return names, nil
+}
+
+// mainClassesOf returns the names of the classes with an entry point in the source.
+func mainClassesOf(source string) (classNames []string) {
+	for _, match := range reMainMethod().FindAllStringSubmatch(source, -1) {
+		classNames = append(classNames, match[1])
+	}
+	for _, match := range reAppObject().FindAllStringSubmatch(source, -1) {
+		classNames = append(classNames, match[1])
+	}
+	if len(classNames) == 0 && reDefMain().MatchString(source) {
+		if match := reObject().FindStringSubmatch(source); match != nil {
+			classNames = append(classNames, match[1])
+		}
+	}
+	return classNames
+}
+
+// findMainClass returns the fully qualified name of the main class for scalac: the one named after the command,
+// the only one in the sources, or the one named after the file as before.
+func findMainClass(target *scalaTargetT) (mainClass string, err error) {
+	defer Catch(&err)
+	var candidates []string
+	for _, sourcePath := range target.sourcePaths {
+		source := string(V(os.ReadFile(sourcePath)))
+		packagePrefix := ""
+		if match := rePackage().FindStringSubmatch(source); match != nil {
+			packagePrefix = match[1] + "."
+		}
+		for _, className := range mainClassesOf(source) {
+			if camel2Kebab(className) == target.cmdBase {
+				return packagePrefix + className, nil
+			}
+			candidates = append(candidates, packagePrefix+className)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	if len(candidates) > 1 {
+		return "", errors.New(fmt.Sprintf("multiple main classes found: %s: %s", target.cmdBase, strings.Join(candidates, ", ")))
+	}
+	if len(target.sourcePaths) == 1 && target.path == target.sourcePaths[0] {
+		return kebab2Camel(target.cmdBase), nil
+	}
+	return "", errors.New(fmt.Sprintf("no main class found: %s", target.cmdBase))
+}
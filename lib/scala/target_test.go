@@ -0,0 +1,66 @@
+package scala
+
+import (
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewScalaTarget(t *testing.T) {
+	dirPath := t.TempDir()
+	cmdDirPath := filepath.Join(dirPath, "word-count")
+	V0(os.MkdirAll(filepath.Join(cmdDirPath, "util"), 0755))
+	V0(os.MkdirAll(filepath.Join(cmdDirPath, ".scala-build"), 0755))
+	V0(os.WriteFile(filepath.Join(cmdDirPath, "Main.scala"), []byte(`//> using scala 3.3.3
+//> using dep com.lihaoyi::os-lib:0.10.0
+package example
+
+@main def wordCount(args: String*): Unit =
+  println(util.Words.count(args))
+`), 0644))
+	V0(os.WriteFile(filepath.Join(cmdDirPath, "util", "Words.scala"), []byte(`package example.util
+
+object Words:
+  def count(args: Seq[String]): Int = args.length
+`), 0644))
+	V0(os.WriteFile(filepath.Join(cmdDirPath, ".scala-build", "Ignored.scala"), nil, 0644))
+
+	target := V(newScalaTarget(cmdDirPath))
+	assert.Equal(t, "word-count", target.cmdBase)
+	assert.Len(t, target.sourcePaths, 2)
+	assert.Equal(t, "example.wordCount", V(findMainClass(target)))
+	assert.Equal(t, []string{"scala", "dep"}, V(usingDirectives(target.sourcePaths)))
+
+	filePath := filepath.Join(dirPath, "HelloWorld.scala")
+	V0(os.WriteFile(filePath, []byte("object Hello {\n  def main(args: Array[String]): Unit = println(\"Hello\")\n}\n"), 0644))
+	target = V(newScalaTarget(filePath))
+	assert.Equal(t, "hello-world", target.cmdBase)
+	assert.Equal(t, "Hello", V(findMainClass(target)))
+}
+
+// A directory is a command with the sources directly in it or under “src”, unless it is a project of a build tool.
+func TestIsCommandDir(t *testing.T) {
+	dirPath := t.TempDir()
+	writeSource := func(relPath string) {
+		V0(os.MkdirAll(filepath.Join(dirPath, filepath.Dir(relPath)), 0755))
+		V0(os.WriteFile(filepath.Join(dirPath, relPath), nil, 0644))
+	}
+	writeSource(filepath.Join("tool", "Tool.scala"))
+	writeSource(filepath.Join("script", "hello.sc"))
+	writeSource(filepath.Join("app", "src", "example", "App.scala"))
+	writeSource(filepath.Join("sbt-project", "build.sbt"))
+	writeSource(filepath.Join("sbt-project", "Main.scala"))
+	writeSource(filepath.Join("mill-project", "build.sc"))
+	writeSource(filepath.Join("mill-project", "src", "Main.scala"))
+	writeSource(filepath.Join("vendor", "lib", "src", "main", "scala", "Lib.scala"))
+	writeSource(filepath.Join("output", "src", "target", "Generated.scala"))
+	assert.True(t, isCommandDir(filepath.Join(dirPath, "tool")))
+	assert.True(t, isCommandDir(filepath.Join(dirPath, "script")))
+	assert.True(t, isCommandDir(filepath.Join(dirPath, "app")))
+	assert.False(t, isCommandDir(filepath.Join(dirPath, "sbt-project")))
+	assert.False(t, isCommandDir(filepath.Join(dirPath, "mill-project")))
+	assert.False(t, isCommandDir(filepath.Join(dirPath, "vendor")))
+	assert.False(t, isCommandDir(filepath.Join(dirPath, "output")))
+}
@@ -0,0 +1,202 @@
+package shebang
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/samber/lo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Extensions which are stripped from the command names.
+var strippedExtensions = []string{
+	".sh",
+	".bash",
+	".pl",
+	".rb",
+}
+
+// Extensions of the sources and the data which are not scripts, even though they are often executable
+// on filesystems such as the mounted Windows drives of WSL.
+var skippedExtensions = []string{
+	".h", ".hh", ".hpp", ".mod", ".sum", ".work", ".cabal", ".nimble", ".lock", ".md", ".txt", ".rst", ".json", ".toml",
+	".yaml", ".yml", ".xml", ".csv", ".ini", ".cfg", ".conf", ".html", ".css", ".log",
+}
+
+// isSkipped checks if the file is a source or data rather than a script, by its extension.
+func isSkipped(filePath string) bool {
+	return slices.Contains(skippedExtensions, strings.ToLower(filepath.Ext(filePath)))
+}
+
+const factoryName = "Shebang Script Manager"
+
+// claimedFilePaths returns the files in the directory which the other managers run, such as the sources of their languages.
+// The sources which no manager runs, for lack of the toolchain or of a manager for the language, are left to this manager.
+func claimedFilePaths(dirPath string) (claimed map[string]bool) {
+	claimed = map[string]bool{}
+	for _, factory := range common.Factories() {
+		if factory.Name == factoryName {
+			continue
+		}
+		manager := factory.NewManager(dirPath)
+		if manager == nil {
+			continue
+		}
+		for _, info := range manager.GetCommandBaseInfoList() {
+			claimed[info.SourcePath] = true
+		}
+	}
+	return claimed
+}
+
+func cmdBaseOf(filePath string) string {
+	base := filepath.Base(filePath)
+	for _, ext := range strippedExtensions {
+		if strings.HasSuffix(base, ext) && len(base) > len(ext) {
+			return base[:len(base)-len(ext)]
+		}
+	}
+	return base
+}
+
+// readShebang returns the interpreter and its arguments in the first line of the file such as “#!/usr/bin/env bash”, or nil if there is none.
+func readShebang(filePath string) (interpreter []string, err error) {
+	defer Catch(&err)
+	in := V(os.Open(filePath))
+	defer (func() { Ignore(in.Close()) })()
+	reader := bufio.NewReader(in)
+	magic := make([]byte, 2)
+	if n, _ := reader.Read(magic); n < 2 || string(magic) != "#!" {
+		return nil, nil
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		return nil, nil
+	}
+	return strings.Fields(line), nil
+}
+
+func isExecutable(stat os.FileInfo) bool {
+	return runtime.GOOS != "windows" && stat.Mode().IsRegular() && stat.Mode()&0111 != 0
+}
+
+// command returns the command line to run the file: the file itself if it is executable, or its interpreter otherwise.
+func command(filePath string) (command []string, err error) {
+	defer Catch(&err)
+	if isExecutable(V(os.Stat(filePath))) {
+		return []string{filePath}, nil
+	}
+	interpreter := V(readShebang(filePath))
+	if len(interpreter) == 0 {
+		return nil, errors.New(fmt.Sprintf("neither executable nor with a shebang: %s", filePath))
+	}
+	// Run “/usr/bin/env” on the platforms without it, such as Windows, by looking up the interpreter on $PATH.
+	if filepath.Base(interpreter[0]) == "env" {
+		if _, err := os.Stat(interpreter[0]); err != nil {
+			interpreter = interpreter[1:]
+			if len(interpreter) > 0 && interpreter[0] == "-S" {
+				interpreter = interpreter[1:]
+			}
+		}
+	}
+	if len(interpreter) == 0 {
+		return nil, errors.New(fmt.Sprintf("invalid shebang: %s", filePath))
+	}
+	return append(interpreter, filePath), nil
+}
+
+// --------
+
+type ShebangManager struct {
+	filePaths []string
+}
+
+var _ common.Manager = &ShebangManager{}
+
+func (m *ShebangManager) findFile(cmdBase string) (filePath string, err error) {
+	for _, filePath := range m.filePaths {
+		if cmdBaseOf(filePath) == cmdBase {
+			return filePath, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("no matching script found: %s", cmdBase))
+}
+
+func (m *ShebangManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
+	for _, filePath := range m.filePaths {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    cmdBaseOf(filePath),
+			SourcePath: filePath,
+		})
+	}
+	return infoList
+}
+
+func (m *ShebangManager) CanRun(cmdBase string) bool {
+	_, err := m.findFile(cmdBase)
+	return err == nil
+}
+
+func (m *ShebangManager) Run(args []string, _ bool) (err error) {
+	defer Catch(&err)
+	command := V(command(V(m.findFile(filepath.Base(args[0])))))
+	cmd := exec.Command(command[0], append(command[1:], args[1:]...)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return common.RunCommand(cmd)
+}
+
+func newShebangManager(dirPath string) common.Manager {
+	var filePaths []string
+	for _, dirEntry := range V(os.ReadDir(dirPath)) {
+		if dirEntry.IsDir() ||
+			strings.HasPrefix(dirEntry.Name(), "_") ||
+			strings.HasPrefix(dirEntry.Name(), ".") {
+			continue
+		}
+		filePath := filepath.Join(dirPath, dirEntry.Name())
+		if isSkipped(filePath) {
+			continue
+		}
+		// Follow symbolic links to find what they point to.
+		stat, err := os.Stat(filePath)
+		if err != nil || !stat.Mode().IsRegular() {
+			continue
+		}
+		if isExecutable(stat) {
+			filePaths = append(filePaths, filePath)
+		} else if interpreter, err := readShebang(filePath); err == nil && len(interpreter) > 0 {
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	if len(filePaths) == 0 {
+		return nil
+	}
+	claimed := claimedFilePaths(dirPath)
+	filePaths = lo.Filter(filePaths, func(filePath string, _ int) bool {
+		return !claimed[filePath]
+	})
+	if len(filePaths) == 0 {
+		return nil
+	}
+	return &ShebangManager{
+		filePaths: filePaths,
+	}
+}
+
+func init() {
+	// The lowest priority, so that the files are run by the managers of their languages if any.
+	common.RegisterManagerFactory(
+		factoryName,
+		newShebangManager,
+		0,
+	)
+}
@@ -0,0 +1,69 @@
+package shebang
+
+import (
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakePythonManagerT runs the Python sources, as the manager of the language does if its toolchain is available.
+type fakePythonManagerT struct {
+	filePaths []string
+}
+
+func (m *fakePythonManagerT) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
+	for _, filePath := range m.filePaths {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    strings.TrimSuffix(filepath.Base(filePath), ".py"),
+			SourcePath: filePath,
+		})
+	}
+	return infoList
+}
+
+func (m *fakePythonManagerT) CanRun(string) bool { return false }
+
+func (m *fakePythonManagerT) Run([]string, bool) error { return nil }
+
+func init() {
+	common.RegisterManagerFactory("Fake Python Manager", func(dirPath string) common.Manager {
+		filePaths := V(filepath.Glob(filepath.Join(dirPath, "*.py")))
+		if len(filePaths) == 0 {
+			return nil
+		}
+		return &fakePythonManagerT{filePaths: filePaths}
+	}, 50)
+}
+
+// The executable files and the ones with a shebang are scripts, except the data and the sources which the other managers run.
+func TestShebangManager(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no executable bits")
+	}
+	dirPath := t.TempDir()
+	V0(os.WriteFile(filepath.Join(dirPath, "hello.sh"), []byte("#!/bin/sh\necho hello\n"), 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, "report.pl"), []byte("#!/usr/bin/env perl\nprint 1;\n"), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "tool.py"), []byte("#!/usr/bin/env python3\n"), 0755))
+	// No manager runs the plain JavaScript sources.
+	V0(os.WriteFile(filepath.Join(dirPath, "serve.js"), []byte("#!/usr/bin/env node\n"), 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, "_hidden.sh"), []byte("#!/bin/sh\n"), 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, ".hidden"), []byte("#!/bin/sh\n"), 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, "notes.txt"), []byte("hello\n"), 0644))
+	// Executable on some filesystems, but not scripts.
+	V0(os.WriteFile(filepath.Join(dirPath, "go.mod"), []byte("module example.com/tools\n"), 0755))
+	V0(os.WriteFile(filepath.Join(dirPath, "README.md"), []byte("# Tools\n"), 0755))
+	manager := newShebangManager(dirPath)
+	var names []string
+	for _, info := range manager.GetCommandBaseInfoList() {
+		names = append(names, info.CmdBase)
+	}
+	assert.Equal(t, []string{"hello", "report", "serve.js"}, names)
+	assert.NotContains(t, names, "tool.py")
+	assert.Equal(t, []string{filepath.Join(dirPath, "hello.sh")}, V(command(filepath.Join(dirPath, "hello.sh"))))
+	assert.Equal(t, []string{"/usr/bin/env", "perl", filepath.Join(dirPath, "report.pl")}, V(command(filepath.Join(dirPath, "report.pl"))))
+}
@@ -0,0 +1,192 @@
+package zig
+
+import (
+	"errors"
+	"fmt"
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/samber/lo"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const zigExt = ".zig"
+
+var reLocalImport = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`@import\("([^"]+\.zig)"\)`)
+})
+
+// localImports returns the source file and the local files it imports transitively. Packages such as “std” are not files.
+func localImports(zigFilePath string) (filePaths []string, err error) {
+	defer Catch(&err)
+	visited := map[string]bool{}
+	queue := []string{zigFilePath}
+	for len(queue) > 0 {
+		filePath := queue[0]
+		queue = queue[1:]
+		if visited[filePath] {
+			continue
+		}
+		visited[filePath] = true
+		filePaths = append(filePaths, filePath)
+		for _, match := range reLocalImport().FindAllStringSubmatch(string(V(os.ReadFile(filePath))), -1) {
+			importedPath := filepath.Join(filepath.Dir(filePath), match[1])
+			if _, err := os.Stat(importedPath); err == nil {
+				queue = append(queue, importedPath)
+			}
+		}
+	}
+	return filePaths, nil
+}
+
+// exeBuildInfo returns the build information of the source file and the path of the cached executable for it.
+func exeBuildInfo(zigFilePath string, cmdBase string) (buildInfo *common.BuildInfo, exePath string, err error) {
+	defer Catch(&err)
+	var fileInfoList []*common.FileInfo
+	for _, filePath := range V(localImports(zigFilePath)) {
+		fileInfoList = append(fileInfoList, V(common.GetFileInfo(filePath)))
+	}
+	buildInfo = common.NewBuildInfo(
+		V(zigVersion()),
+		common.BuildFlags("zig", filepath.Dir(zigFilePath)),
+		fileInfoList,
+	)
+	exePath = V(common.CachedExePath(buildInfo.Hash, cmdBase))
+	return buildInfo, exePath, nil
+}
+
+func ensureExeFile(zigFilePath string, cmdBase string, shouldRebuild bool) (buildInfo *common.BuildInfo, exePath string, err error) {
+	defer Catch(&err)
+	buildInfo, exePath, err = exeBuildInfo(zigFilePath, cmdBase)
+	if err != nil {
+		return nil, "", err
+	}
+	V0(common.EnsureBuilt(buildInfo, exePath, shouldRebuild, func(tempPath string) error {
+		// Keep the intermediate files out of the directory of the source and of the cache entry.
+		zigCacheDirPath := tempPath + "-zig-cache"
+		defer (func() { Ignore(os.RemoveAll(zigCacheDirPath)) })()
+		args := []string{"build-exe"}
+		args = append(args, buildInfo.Args...)
+		args = append(args, "--cache-dir", zigCacheDirPath, "-femit-bin="+tempPath, zigFilePath)
+		cmd := exec.Command(V(zigCommand()), args...)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}))
+	return buildInfo, exePath, nil
+}
+
+// --------
+
+type ZigFileManager struct {
+	zigFilePaths []string
+}
+
+var _ common.Manager = &ZigFileManager{}
+var _ common.CacheChecker = &ZigFileManager{}
+var _ common.Builder = &ZigFileManager{}
+var _ common.FastLauncher = &ZigFileManager{}
+
+func (m *ZigFileManager) findSource(cmdBase string) (zigFilePath string, err error) {
+	for _, zigFilePath := range m.zigFilePaths {
+		if filepath.Base(zigFilePath) == cmdBase+zigExt {
+			return zigFilePath, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("no matching zig file found: %s", cmdBase))
+}
+
+func (m *ZigFileManager) GetCommandBaseInfoList() (infoList []*common.CommandBaseInfo) {
+	for _, zigFilePath := range m.zigFilePaths {
+		infoList = append(infoList, &common.CommandBaseInfo{
+			CmdBase:    strings.TrimSuffix(filepath.Base(zigFilePath), zigExt),
+			SourcePath: zigFilePath,
+		})
+	}
+	return infoList
+}
+
+func (m *ZigFileManager) CanRun(cmdBase string) bool {
+	_, err := m.findSource(cmdBase)
+	return err == nil
+}
+
+func (m *ZigFileManager) Run(args []string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	cmdBase := filepath.Base(args[0])
+	_, exePath, err := ensureExeFile(V(m.findSource(cmdBase)), cmdBase, shouldRebuild)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exePath, args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return common.RunCommand(cmd)
+}
+
+func (m *ZigFileManager) Build(cmdBase string, shouldRebuild bool) (err error) {
+	defer Catch(&err)
+	_, _, err = ensureExeFile(V(m.findSource(cmdBase)), cmdBase, shouldRebuild)
+	return err
+}
+
+func (m *ZigFileManager) CachedPath(cmdBase string) (cachedPath string, err error) {
+	defer Catch(&err)
+	_, cachedPath, err = exeBuildInfo(V(m.findSource(cmdBase)), cmdBase)
+	return cachedPath, err
+}
+
+func (m *ZigFileManager) LaunchStamp(cmdBase string, shouldRebuild bool) (stamp *common.LaunchStamp, err error) {
+	defer Catch(&err)
+	buildInfo, exePath, err := ensureExeFile(V(m.findSource(cmdBase)), cmdBase, shouldRebuild)
+	if err != nil {
+		return nil, err
+	}
+	return common.NewLaunchStamp([]string{exePath}, exePath, buildInfo, nil, V(zigCommand())), nil
+}
+
+var zigCommand = sync.OnceValues(func() (zigPath string, err error) {
+	defer Catch(&err)
+	if path := common.ToolPath("zig"); path != "" {
+		return path, nil
+	}
+	return V(exec.LookPath("zig")), nil
+})
+
+// zigVersion returns the version of the compiler such as “0.13.0”.
+var zigVersion = sync.OnceValues(func() (version string, err error) {
+	defer Catch(&err)
+	return strings.TrimSpace(string(V(exec.Command(V(zigCommand()), "version").Output()))), nil
+})
+
+func newZigFileManager(dirPath string) common.Manager {
+	if _, err := zigCommand(); err != nil {
+		return nil
+	}
+	zigFilePaths := V(filepath.Glob(filepath.Join(dirPath, "*"+zigExt)))
+	zigFilePaths = lo.Filter(zigFilePaths, func(zigFilePath string, _ int) bool {
+		return !strings.HasPrefix(filepath.Base(zigFilePath), "_") &&
+			!strings.HasPrefix(filepath.Base(zigFilePath), ".") &&
+			// The build scripts of Zig projects are not commands.
+			filepath.Base(zigFilePath) != "build.zig"
+	})
+	if len(zigFilePaths) == 0 {
+		return nil
+	}
+	return &ZigFileManager{
+		zigFilePaths: zigFilePaths,
+	}
+}
+
+func init() {
+	common.RegisterManagerFactory(
+		"Zig File Manager",
+		newZigFileManager,
+		50,
+	)
+}
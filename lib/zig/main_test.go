@@ -0,0 +1,70 @@
+package zig
+
+import (
+	"github.com/knaka/binc/lib/common"
+	. "github.com/knaka/go-utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalImports(t *testing.T) {
+	dirPath := t.TempDir()
+	mainFilePath := filepath.Join(dirPath, "main.zig")
+	V0(os.MkdirAll(filepath.Join(dirPath, "lib"), 0755))
+	V0(os.WriteFile(mainFilePath, []byte(`const std = @import("std");
+const util = @import("lib/util.zig");
+
+pub fn main() void {
+    util.hello();
+}
+`), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "lib", "util.zig"), []byte(`const fmt = @import("fmt.zig");
+pub fn hello() void {}
+`), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "lib", "fmt.zig"), []byte("pub const x = 1;\n"), 0644))
+	assert.Equal(t, []string{
+		mainFilePath,
+		filepath.Join(dirPath, "lib", "util.zig"),
+		filepath.Join(dirPath, "lib", "fmt.zig"),
+	}, V(localImports(mainFilePath)))
+}
+
+// fakeZig reports its version and “compiles” a source into a script which prints the path of the source.
+const fakeZig = `#!/bin/sh
+if [ "$1" = version ]; then
+  echo 0.0.0-fake
+  exit 0
+fi
+for arg in "$@"; do
+  case "$arg" in
+  -femit-bin=*) out="${arg#-femit-bin=}" ;;
+  *.zig) src="$arg" ;;
+  esac
+done
+printf '#!/bin/sh\necho %s\n' "$src" > "$out"
+chmod +x "$out"
+`
+
+// A source is compiled into the cache, and editing a file it imports changes the cache entry.
+func TestEnsureExeFile(t *testing.T) {
+	common.InstallFakeTool(t, "zig", fakeZig)
+	dirPath := t.TempDir()
+	mainFilePath := filepath.Join(dirPath, "hello.zig")
+	V0(os.WriteFile(mainFilePath, []byte("const util = @import(\"util.zig\");\npub fn main() void { util.hello(); }\n"), 0644))
+	V0(os.WriteFile(filepath.Join(dirPath, "util.zig"), []byte("pub fn hello() void {}\n"), 0644))
+
+	buildInfo, exePath, err := ensureExeFile(mainFilePath, "hello", false)
+	V0(err)
+	assert.Equal(t, mainFilePath+"\n", string(V(exec.Command(exePath).Output())))
+	assert.Empty(t, V(filepath.Glob(filepath.Join(filepath.Dir(exePath), "*-zig-cache"))))
+
+	V0(os.WriteFile(filepath.Join(dirPath, "util.zig"), []byte("pub fn hello() void { _ = 1; }\n"), 0644))
+	otherBuildInfo, otherExePath, err := ensureExeFile(mainFilePath, "hello", false)
+	V0(err)
+	assert.NotEqual(t, buildInfo.HashStr, otherBuildInfo.HashStr)
+	assert.NotEqual(t, exePath, otherExePath)
+	assert.FileExists(t, otherExePath)
+}